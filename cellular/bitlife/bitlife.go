@@ -0,0 +1,320 @@
+/*
+Package bitlife is a Life engine for rules with only two states, which keeps
+64 cells in every word, one bit per cell.
+
+Instead of asking a Rule about one cell at a time, like the engine package
+does, it counts the neighbors of 64 cells at once, with the same adders that
+a CPU uses to add numbers: the count of every cell is kept in 4 words, one
+for each bit of the count, and the 8 neighbors are added in one at a time.
+That makes it fast enough, and small enough, for boards with millions of
+cells, like a forest of trees that grows across a whole map.
+
+It runs any Life-like rule (like B3/S23, or B36/S23) on a square grid, with
+any of the engine's topologies.  Generations rules and hex rules have more
+than two states, or other neighbors, so they need the engine package.
+*/
+package bitlife
+
+import (
+	"fmt"
+	"math/bits"
+
+	"github.com/fractalbach/fractalnet/cellular/engine"
+)
+
+// ===========================================================================
+//      Boards
+// ___________________________________________________________________________
+
+/*
+The cells are kept row by row.  Each row starts on a new word, and cell x of
+a row is bit x%64 of word x/64, starting from the lowest bit:
+
+        x:      63 ........ 2 1 0     127 ....... 66 65 64
+                +-----------------+   +--------------------+
+        row y:  |     word 0      |   |       word 1       |   ...
+                +-----------------+   +--------------------+
+
+The bits past the width of the board, at the end of the last word of each
+row, are always 0.
+*/
+
+// WORD_BITS is the number of cells in each word.
+const WORD_BITS = 64
+
+// Board is a field of cells that are either dead or alive.
+type Board struct {
+	w, h int
+
+	// words is the number of words in each row.
+	words int
+
+	// cells has words*h words, row by row, and next is where the next
+	// generation is written, before they are swapped.
+	cells, next []uint64
+
+	// lastMask has a bit for every cell of the last word of a row.
+	lastMask uint64
+
+	topology string
+	rule     *engine.LifeLike
+
+	// birth[n] and survive[n] are the rule's counts as masks, so that they
+	// can be used with bitwise operations.
+	birth, survive [9]uint64
+}
+
+// New returns a board of w*h dead cells, with Conway's rule.
+func New(w, h int) *Board {
+	if w < 0 {
+		w = 0
+	}
+	if h < 0 {
+		h = 0
+	}
+	words := (w + WORD_BITS - 1) / WORD_BITS
+	b := &Board{
+		w: w, h: h,
+		words:    words,
+		cells:    make([]uint64, words*h),
+		next:     make([]uint64, words*h),
+		lastMask: ^uint64(0),
+		topology: engine.TOPOLOGY_BOUNDED,
+	}
+	if r := uint(w % WORD_BITS); r != 0 {
+		b.lastMask = 1<<r - 1
+	}
+	b.SetRule(engine.MustParseRule("B3/S23"))
+	return b
+}
+
+// Width returns the number of cells in each row.
+func (b *Board) Width() int {
+	return b.w
+}
+
+// Height returns the number of rows.
+func (b *Board) Height() int {
+	return b.h
+}
+
+// Alive reports whether the cell at (x,y) is alive.  Cells past the edge
+// depend on the topology, like they do on an engine.Field.
+func (b *Board) Alive(x, y int) bool {
+	x, y, ok := engine.Wrap(b.topology, x, y, b.w, b.h)
+	if !ok {
+		return false
+	}
+	return b.cells[y*b.words+x/WORD_BITS]>>uint(x%WORD_BITS)&1 != 0
+}
+
+// Set makes the cell at (x,y) alive or dead.  Cells outside of the board
+// are ignored.
+func (b *Board) Set(x, y int, alive bool) {
+	if x < 0 || y < 0 || x >= b.w || y >= b.h {
+		return
+	}
+	i, bit := y*b.words+x/WORD_BITS, uint64(1)<<uint(x%WORD_BITS)
+	if alive {
+		b.cells[i] |= bit
+	} else {
+		b.cells[i] &^= bit
+	}
+}
+
+// Count returns the number of living cells.
+func (b *Board) Count() int {
+	n := 0
+	for _, word := range b.cells {
+		n += bits.OnesCount64(word)
+	}
+	return n
+}
+
+// Clear kills every cell.
+func (b *Board) Clear() {
+	for i := range b.cells {
+		b.cells[i] = 0
+	}
+}
+
+// Topology returns what the cells on the edge see past the edge.
+func (b *Board) Topology() string {
+	return b.topology
+}
+
+// SetTopology changes what the cells on the edge see past the edge: one of
+// the engine's topologies.
+func (b *Board) SetTopology(t string) error {
+	if err := engine.ValidTopology(t); err != nil {
+		return err
+	}
+	if t == "" {
+		t = engine.TOPOLOGY_BOUNDED
+	}
+	b.topology = t
+	return nil
+}
+
+// Rule returns the rule of the board.
+func (b *Board) Rule() *engine.LifeLike {
+	return b.rule
+}
+
+// SetRule changes the rule of the board.  It must be a Life-like rule with
+// two states, on a square grid.
+func (b *Board) SetRule(r *engine.LifeLike) error {
+	if r.States > 2 {
+		return fmt.Errorf("%s has %d states, but a bit board only has 2",
+			r, r.States)
+	}
+	if r.Hex {
+		return fmt.Errorf("%s is for a hex grid, but a bit board is square", r)
+	}
+	for n := range b.birth {
+		b.birth[n] = mask(r.Birth[n])
+		b.survive[n] = mask(r.Survive[n])
+	}
+	b.rule = r
+	return nil
+}
+
+// mask returns a word with every bit set if ok is true, or none if not.
+func mask(ok bool) uint64 {
+	if ok {
+		return ^uint64(0)
+	}
+	return 0
+}
+
+// ===========================================================================
+//      Stepping
+// ___________________________________________________________________________
+
+/*
+For every word of a row, the 8 neighbors of its 64 cells are 8 words: the
+rows above and below, as they are, and the three rows shifted by one cell to
+the left and to the right.  Shifting a word moves a bit in from the word
+next to it (or from past the edge, for the first and last words).
+
+The neighbors are added into a count of 4 words (s0 has the 1s bit of each
+count, s1 the 2s bit, s2 the 4s bit and s3 the 8s bit), like this:
+
+        carry = s0 & n;   s0 ^= n
+        carry2 = s1 & carry;   s1 ^= carry
+        ...
+
+Then, a cell is alive in the next generation if its count is one of the
+rule's counts for birth (if it was dead) or survival (if it was alive).
+*/
+
+// Step moves the board forward by one generation.
+func (b *Board) Step() {
+	if b.w == 0 || b.h == 0 {
+		return
+	}
+	for y := 0; y < b.h; y++ {
+		up, upOk := b.row(y - 1)
+		down, downOk := b.row(y + 1)
+		me := b.cells[y*b.words : (y+1)*b.words]
+		out := b.next[y*b.words : (y+1)*b.words]
+		for k := range me {
+			var s0, s1, s2, s3 uint64
+			if upOk {
+				s0, s1, s2, s3 = add(s0, s1, s2, s3, up[k])
+				s0, s1, s2, s3 = add(s0, s1, s2, s3, b.west(up, k))
+				s0, s1, s2, s3 = add(s0, s1, s2, s3, b.east(up, k))
+			}
+			s0, s1, s2, s3 = add(s0, s1, s2, s3, b.west(me, k))
+			s0, s1, s2, s3 = add(s0, s1, s2, s3, b.east(me, k))
+			if downOk {
+				s0, s1, s2, s3 = add(s0, s1, s2, s3, down[k])
+				s0, s1, s2, s3 = add(s0, s1, s2, s3, b.west(down, k))
+				s0, s1, s2, s3 = add(s0, s1, s2, s3, b.east(down, k))
+			}
+
+			var born, lives uint64
+			for n := 0; n <= 8; n++ {
+				if b.birth[n]|b.survive[n] == 0 {
+					continue
+				}
+				is := countIs(n, s0, s1, s2, s3)
+				born |= is & b.birth[n]
+				lives |= is & b.survive[n]
+			}
+			out[k] = me[k]&lives | ^me[k]&born
+		}
+		out[len(out)-1] &= b.lastMask
+	}
+	b.cells, b.next = b.next, b.cells
+}
+
+// StepN moves the board forward by n generations.
+func (b *Board) StepN(n int) {
+	for i := 0; i < n; i++ {
+		b.Step()
+	}
+}
+
+// add adds a word of neighbors (one bit for each cell) to the counts.
+func add(s0, s1, s2, s3, n uint64) (uint64, uint64, uint64, uint64) {
+	c0 := s0 & n
+	c1 := s1 & c0
+	return s0 ^ n, s1 ^ c0, s2 ^ c1, s3 | s2&c1
+}
+
+// countIs returns a word with the bits set where the count is n.
+func countIs(n int, s0, s1, s2, s3 uint64) uint64 {
+	is := ^uint64(0)
+	for i, s := range [4]uint64{s0, s1, s2, s3} {
+		if n>>uint(i)&1 != 0 {
+			is &= s
+		} else {
+			is &^= s
+		}
+	}
+	return is
+}
+
+// row returns the words of row y, which can be past the top or bottom edge.
+// It returns false if there is no row there.
+func (b *Board) row(y int) ([]uint64, bool) {
+	_, y, ok := engine.Wrap(b.topology, 0, y, b.w, b.h)
+	if !ok {
+		return nil, false
+	}
+	return b.cells[y*b.words : (y+1)*b.words], true
+}
+
+// west returns word k of the row, shifted so that each bit holds the cell
+// to its left (at x-1).
+func (b *Board) west(row []uint64, k int) uint64 {
+	var in uint64
+	if k > 0 {
+		in = row[k-1] >> (WORD_BITS - 1)
+	} else {
+		in = b.edge(row, -1)
+	}
+	return row[k]<<1 | in
+}
+
+// east returns word k of the row, shifted so that each bit holds the cell
+// to its right (at x+1).
+func (b *Board) east(row []uint64, k int) uint64 {
+	w := row[k] >> 1
+	if k < len(row)-1 {
+		return w | row[k+1]<<(WORD_BITS-1)
+	}
+	// The last cell of the row is at bit (w-1)%64 of the last word.
+	return w | b.edge(row, b.w)<<uint((b.w-1)%WORD_BITS)
+}
+
+// edge returns the cell at x (just past the left or right edge) of the row
+// as a 0 or 1.
+func (b *Board) edge(row []uint64, x int) uint64 {
+	x, _, ok := engine.Wrap(b.topology, x, 0, b.w, b.h)
+	if !ok {
+		return 0
+	}
+	return row[x/WORD_BITS] >> uint(x%WORD_BITS) & 1
+}
@@ -0,0 +1,103 @@
+package bitlife
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/fractalbach/fractalnet/cellular/engine"
+)
+
+// randomBoard returns a w*h board where about a third of the cells are
+// alive.
+func randomBoard(w, h int, seed int64) *Board {
+	r := rand.New(rand.NewSource(seed))
+	b := New(w, h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			b.Set(x, y, r.Intn(3) == 0)
+		}
+	}
+	return b
+}
+
+func TestStepMatchesEngine(t *testing.T) {
+	const generations = 8
+	rules := []string{
+		"B3/S23",       // Conway
+		"B36/S23",      // HighLife
+		"B2/S",         // Seeds
+		"B1357/S1357",  // Replicator
+		"B3678/S34678", // Day & Night
+		"B/S012345678", // nothing is born, and nothing dies
+	}
+	topologies := []string{
+		engine.TOPOLOGY_BOUNDED,
+		engine.TOPOLOGY_TORUS,
+		engine.TOPOLOGY_MIRROR,
+	}
+	for _, rulestring := range rules {
+		rule := engine.MustParseRule(rulestring)
+		for _, topology := range topologies {
+			// The widths are around the size of a word, where the cells
+			// past the edge come from the next word, or from the edge.
+			for _, w := range []int{1, 63, 64, 65} {
+				for _, h := range []int{1, 2, 9} {
+					b := randomBoard(w, h, int64(w*h))
+					b.SetRule(rule)
+					b.SetTopology(topology)
+					src := b.Field()
+					dst := engine.NewField(w, h)
+					dst.SetTopology(topology)
+					for i := 0; i < generations; i++ {
+						b.Step()
+						engine.Step(rule, src, dst, nil)
+						src, dst = dst, src
+						if !bytes.Equal(b.Field().Bytes(), src.Bytes()) {
+							t.Errorf("%s on a %s %dx%d board: generation "+
+								"%d doesn't match engine.Step",
+								rulestring, topology, w, h, i+1)
+							break
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	for _, w := range []int{0, 1, 63, 64, 65} {
+		for _, h := range []int{0, 1, 3} {
+			b := randomBoard(w, h, 1)
+			data, _ := b.Compress()
+			c, err := Decompress(data, w, h)
+			if err != nil {
+				t.Fatalf("%dx%d: %v", w, h, err)
+			}
+			if !bytes.Equal(c.Field().Bytes(), b.Field().Bytes()) {
+				t.Errorf("%dx%d: the board changed after Compress and "+
+					"Decompress", w, h)
+			}
+		}
+	}
+	if _, err := Decompress([]byte{0}, 3, 3); err == nil {
+		t.Errorf("Decompress read 9 cells from 1 byte")
+	}
+}
+
+// BenchmarkStep steps a board of random cells with Conway's rule, once per
+// op, with the same sizes as the benchmarks of the engine package.
+func BenchmarkStep(b *testing.B) {
+	for _, size := range []int{256, 1024, 2048} {
+		b.Run(fmt.Sprintf("%dx%d", size, size), func(b *testing.B) {
+			board := randomBoard(size, size, 1)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				board.Step()
+			}
+		})
+	}
+}
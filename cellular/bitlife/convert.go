@@ -0,0 +1,108 @@
+package bitlife
+
+import (
+	"fmt"
+
+	"github.com/fractalbach/fractalnet/cellular/engine"
+)
+
+// ===========================================================================
+//      Converting Boards
+// ___________________________________________________________________________
+
+// FromField returns a board with the cells of the field that aren't 0 alive,
+// and the same topology.
+func FromField(f *engine.Field) *Board {
+	b := FromBuffer(f.Buffer())
+	b.SetTopology(f.Topology())
+	return b
+}
+
+// FromBuffer returns a board with the cells of the buffer that aren't 0
+// alive.
+func FromBuffer(cells engine.Buffer) *Board {
+	b := New(cells.Width(), cells.Height())
+	for y := 0; y < b.h; y++ {
+		for x, v := range cells.Row(y) {
+			if v != 0 {
+				b.cells[y*b.words+x/WORD_BITS] |= 1 << uint(x%WORD_BITS)
+			}
+		}
+	}
+	return b
+}
+
+// Field returns a field with the same cells as the board, where living
+// cells are 1, and the same topology.
+func (b *Board) Field() *engine.Field {
+	f := engine.NewField(b.w, b.h)
+	f.SetTopology(b.topology)
+	f.Buffer().CopyFrom(b.Buffer())
+	return f
+}
+
+// Buffer returns the cells of the board, one byte per cell, where living
+// cells are 1.
+func (b *Board) Buffer() engine.Buffer {
+	cells := engine.NewBuffer(b.w, b.h)
+	for y := 0; y < b.h; y++ {
+		row := cells.Row(y)
+		words := b.cells[y*b.words : (y+1)*b.words]
+		for x := range row {
+			row[x] = uint8(words[x/WORD_BITS] >> uint(x%WORD_BITS) & 1)
+		}
+	}
+	return cells
+}
+
+/*
+Compressed boards are in the same form as the bytes of CompressBoolGrid in
+the game package, which sends grids of trees to the clients.  That grid is a
+list of columns, so the cells go down each column, one column at a time:
+
+        (0,0) (0,1) ... (0,h-1) (1,0) (1,1) ... (w-1,h-1)
+
+Every 8 cells are a byte, starting from the lowest bit, and the last byte
+has the leftover (w*h)%8 cells, if there are any.
+*/
+
+// Compress returns the cells of the board in the form of CompressBoolGrid,
+// and the number of cells in the last byte, which is (w*h)%8.
+func (b *Board) Compress() ([]byte, int) {
+	out := make([]byte, (b.w*b.h+7)/8)
+	i := 0
+	for x := 0; x < b.w; x++ {
+		word, bit := x/WORD_BITS, uint(x%WORD_BITS)
+		for y := 0; y < b.h; y++ {
+			if b.cells[y*b.words+word]>>bit&1 != 0 {
+				out[i/8] |= 1 << uint(i%8)
+			}
+			i++
+		}
+	}
+	return out, b.w * b.h % 8
+}
+
+// Decompress returns a board of w*h cells from the bytes of Compress, or of
+// CompressBoolGrid.
+func Decompress(data []byte, w, h int) (*Board, error) {
+	if w < 0 || h < 0 {
+		return nil, fmt.Errorf("%d x %d is not a size", w, h)
+	}
+	if need := (w*h + 7) / 8; len(data) != need {
+		return nil, fmt.Errorf("a %d x %d board needs %d bytes, but has %d",
+			w, h, need, len(data))
+	}
+	b := New(w, h)
+	i := 0
+	for x := 0; x < w; x++ {
+		word, bit := x/WORD_BITS, uint(x%WORD_BITS)
+		for y := 0; y < h; y++ {
+			if data[i/8]>>uint(i%8)&1 != 0 {
+				b.cells[y*b.words+word] |= 1 << bit
+			}
+			i++
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,193 @@
+package engine
+
+// ===========================================================================
+//      Buffers
+// ___________________________________________________________________________
+
+/*
+A Buffer is a rectangle of cells, kept in a single slice, row by row.  The
+cell at (x,y) is at index y*Stride + x:
+
+        stride = 5
+        +---+---+---+---+---+
+        | 0 | 1 | 2 | 3 | 4 |      row 0
+        +---+---+---+---+---+
+        | 5 | 6 | 7 | 8 | 9 |      row 1
+        +---+---+---+---+---+
+
+A View is a smaller rectangle inside of a Buffer.  It shares the cells of
+the Buffer, so changing one changes the other; only its start, width and
+height are different.  The stride stays the same, so the rows of a View
+have gaps between them, and its cells are only one slice if it is as wide
+as the Buffer that it came from.
+*/
+
+// Buffer is a rectangle of cells, stored row-major in one slice.  The zero
+// Buffer is empty.  Copying a Buffer doesn't copy its cells.
+type Buffer struct {
+	cells  []uint8
+	w, h   int
+	stride int
+}
+
+// NewBuffer returns a buffer of w*h cells that are all 0.
+func NewBuffer(w, h int) Buffer {
+	if w < 0 {
+		w = 0
+	}
+	if h < 0 {
+		h = 0
+	}
+	return Buffer{cells: make([]uint8, w*h), w: w, h: h, stride: w}
+}
+
+// Width returns the number of cells in each row.
+func (b Buffer) Width() int {
+	return b.w
+}
+
+// Height returns the number of rows.
+func (b Buffer) Height() int {
+	return b.h
+}
+
+// Stride returns the distance between the starts of two rows, in cells.
+func (b Buffer) Stride() int {
+	return b.stride
+}
+
+// Contains reports whether (x,y) is inside of the buffer.
+func (b Buffer) Contains(x, y int) bool {
+	return x >= 0 && y >= 0 && x < b.w && y < b.h
+}
+
+// Index returns where the cell at (x,y) is kept.  It doesn't check that the
+// cell is inside of the buffer.
+func (b Buffer) Index(x, y int) int {
+	return y*b.stride + x
+}
+
+// At returns the cell at (x,y).  It panics if the cell is outside of the
+// buffer, like indexing a slice does.
+func (b Buffer) At(x, y int) uint8 {
+	b.check(x, y)
+	return b.cells[y*b.stride+x]
+}
+
+// Set changes the cell at (x,y).  It panics if the cell is outside of the
+// buffer.
+func (b Buffer) Set(x, y int, v uint8) {
+	b.check(x, y)
+	b.cells[y*b.stride+x] = v
+}
+
+// check panics if (x,y) is outside of the buffer.  Without it, an x that is
+// too large would quietly read a cell from the next row.
+func (b Buffer) check(x, y int) {
+	if !b.Contains(x, y) {
+		panic("engine: cell is outside of the buffer")
+	}
+}
+
+// Row returns the cells of row y.  It shares the cells of the buffer.
+func (b Buffer) Row(y int) []uint8 {
+	if y < 0 || y >= b.h {
+		panic("engine: row is outside of the buffer")
+	}
+	i := y * b.stride
+	return b.cells[i : i+b.w : i+b.w]
+}
+
+// View returns the rectangle of w*h cells with its top left corner at
+// (x,y).  It shares the cells of the buffer.  The rectangle is cut down to
+// fit in the buffer, so it can be empty.
+func (b Buffer) View(x, y, w, h int) Buffer {
+	// The sizes can come from players, so nothing here adds two of them
+	// together: x+w could wrap around to a negative number and get past
+	// the checks.
+	if w <= 0 || h <= 0 || x >= b.w || y >= b.h {
+		return Buffer{}
+	}
+	if x < 0 {
+		w, x = w+x, 0
+	}
+	if y < 0 {
+		h, y = h+y, 0
+	}
+	if w > b.w-x {
+		w = b.w - x
+	}
+	if h > b.h-y {
+		h = b.h - y
+	}
+	if w <= 0 || h <= 0 {
+		return Buffer{}
+	}
+	start := y*b.stride + x
+	end := start + (h-1)*b.stride + w
+	return Buffer{cells: b.cells[start:end:end], w: w, h: h, stride: b.stride}
+}
+
+// Contiguous reports whether the cells of the buffer are one slice, with no
+// gaps between the rows.
+func (b Buffer) Contiguous() bool {
+	return b.stride == b.w || b.h <= 1
+}
+
+// Bytes returns the cells, row by row.  If the buffer is contiguous, then
+// they aren't copied: the slice shares the cells of the buffer, so it must
+// not be kept or changed by anything that doesn't own the buffer.  The
+// cells of a View with gaps are copied.
+func (b Buffer) Bytes() []uint8 {
+	if b.Contiguous() {
+		n := b.w * b.h
+		return b.cells[:n:n]
+	}
+	return b.Copy().cells
+}
+
+// Copy returns a new, contiguous buffer with the same cells.
+func (b Buffer) Copy() Buffer {
+	c := NewBuffer(b.w, b.h)
+	c.CopyFrom(b)
+	return c
+}
+
+// CopyFrom copies as many cells from src as fit, starting from the top left
+// corner of both buffers.
+func (b Buffer) CopyFrom(src Buffer) {
+	if b.Contiguous() && src.Contiguous() && b.w == src.w {
+		copy(b.Bytes(), src.Bytes())
+		return
+	}
+	h := b.h
+	if src.h < h {
+		h = src.h
+	}
+	for y := 0; y < h; y++ {
+		copy(b.Row(y), src.Row(y))
+	}
+}
+
+// Fill sets every cell of the buffer to v.
+func (b Buffer) Fill(v uint8) {
+	for y := 0; y < b.h; y++ {
+		row := b.Row(y)
+		for x := range row {
+			row[x] = v
+		}
+	}
+}
+
+// Count returns the number of cells with the value v.
+func (b Buffer) Count(v uint8) int {
+	n := 0
+	for y := 0; y < b.h; y++ {
+		for _, c := range b.Row(y) {
+			if c == v {
+				n++
+			}
+		}
+	}
+	return n
+}
@@ -0,0 +1,199 @@
+package engine
+
+import (
+	"math"
+	"testing"
+)
+
+// numbered returns a w*h buffer where each cell is its index, so that a
+// view shows which cells it has.
+func numbered(w, h int) Buffer {
+	b := NewBuffer(w, h)
+	for i := range b.cells {
+		b.cells[i] = uint8(i)
+	}
+	return b
+}
+
+func TestViewOutOfRange(t *testing.T) {
+	b := numbered(5, 4)
+	tests := []struct {
+		name       string
+		x, y, w, h int
+		wantW      int
+		wantH      int
+		wantFirst  uint8
+	}{
+		{"inside", 1, 1, 2, 2, 2, 2, 6},
+		{"whole", 0, 0, 5, 4, 5, 4, 0},
+		{"past the right", 3, 0, 10, 2, 2, 2, 3},
+		{"past the bottom", 0, 2, 2, 10, 2, 2, 10},
+		{"before the left", -2, 0, 4, 1, 2, 1, 0},
+		{"before the top", 0, -3, 1, 4, 1, 1, 0},
+		{"negative width", 1, 1, -2, 2, 0, 0, 0},
+		{"negative height", 1, 1, 2, -2, 0, 0, 0},
+		{"zero size", 1, 1, 0, 0, 0, 0, 0},
+		{"starts past the right", 5, 0, 2, 2, 0, 0, 0},
+		{"starts past the bottom", 0, 4, 2, 2, 0, 0, 0},
+		{"ends before the left", -3, 0, 3, 2, 0, 0, 0},
+		{"far away", 1000, 1000, 5, 5, 0, 0, 0},
+		{"huge size", 1, 1, math.MaxInt64, math.MaxInt64, 4, 3, 6},
+		{"huge size past the edge", 4, 3,
+			math.MaxInt64, math.MaxInt64, 1, 1, 19},
+		{"huge negative corner", math.MinInt64, math.MinInt64, 2, 2, 0, 0, 0},
+		{"huge negative corner and size", math.MinInt64, 0,
+			math.MaxInt64, 1, 0, 0, 0},
+		{"huge corner", math.MaxInt64, math.MaxInt64, 2, 2, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		v := b.View(tt.x, tt.y, tt.w, tt.h)
+		if v.Width() != tt.wantW || v.Height() != tt.wantH {
+			t.Errorf("%s: View(%d, %d, %d, %d) is %d x %d, want %d x %d",
+				tt.name, tt.x, tt.y, tt.w, tt.h,
+				v.Width(), v.Height(), tt.wantW, tt.wantH)
+			continue
+		}
+		if tt.wantW > 0 && v.At(0, 0) != tt.wantFirst {
+			t.Errorf("%s: the first cell is %d, want %d",
+				tt.name, v.At(0, 0), tt.wantFirst)
+		}
+	}
+}
+
+func TestViewSharesCells(t *testing.T) {
+	b := numbered(5, 4)
+	v := b.View(1, 1, 3, 2)
+	if v.Stride() != b.Stride() || v.Contiguous() {
+		t.Errorf("a 3 wide view of a 5 wide buffer has a stride of %d, "+
+			"and Contiguous is %v", v.Stride(), v.Contiguous())
+	}
+	want := []uint8{6, 7, 8, 11, 12, 13}
+	if got := v.Bytes(); string(got) != string(want) {
+		t.Errorf("the view has the cells %v, want %v", got, want)
+	}
+
+	// Changing the view changes the buffer, and the other way around.
+	v.Set(2, 1, 99)
+	if b.At(3, 2) != 99 {
+		t.Errorf("a change to the view didn't change the buffer")
+	}
+	b.Set(1, 1, 77)
+	if v.At(0, 0) != 77 {
+		t.Errorf("a change to the buffer didn't change the view")
+	}
+
+	// The cells of a view with gaps are copied, so changing them doesn't
+	// change anything.
+	v.Bytes()[0] = 1
+	if b.At(1, 1) != 77 {
+		t.Errorf("changing the copied cells of a view changed the buffer")
+	}
+
+	// A view can't reach past its own rows, even though the cells after
+	// it are in the same slice.
+	defer func() {
+		if recover() == nil {
+			t.Errorf("reading past the right edge of a view didn't panic")
+		}
+	}()
+	v.At(3, 0)
+}
+
+func TestViewOfView(t *testing.T) {
+	b := numbered(8, 8)
+	v := b.View(2, 2, 4, 4).View(1, -1, 10, 2)
+	if v.Width() != 3 || v.Height() != 1 || v.At(0, 0) != 19 {
+		t.Errorf("the view of a view is %d x %d, starting at %d, "+
+			"want 3 x 1, starting at 19", v.Width(), v.Height(), v.At(0, 0))
+	}
+}
+
+func TestBytesRoundTrip(t *testing.T) {
+	b := numbered(7, 3)
+
+	// A whole buffer is contiguous, so Bytes shares its cells.
+	data := b.Bytes()
+	if len(data) != 21 || cap(data) != 21 {
+		t.Fatalf("Bytes has len %d and cap %d, want 21", len(data), cap(data))
+	}
+	data[20] = 200
+	if b.At(6, 2) != 200 {
+		t.Errorf("Bytes of a contiguous buffer is a copy")
+	}
+
+	c := NewBuffer(7, 3)
+	copy(c.Bytes(), b.Bytes())
+	if string(c.Bytes()) != string(b.Bytes()) {
+		t.Errorf("copying Bytes into another buffer lost some cells")
+	}
+
+	// A view as wide as the buffer is contiguous too.
+	rows := b.View(0, 1, 7, 2)
+	if !rows.Contiguous() || string(rows.Bytes()) != string(data[7:]) {
+		t.Errorf("a view of whole rows isn't the same as the rows")
+	}
+
+	// Copy and CopyFrom give contiguous buffers with the same cells, even
+	// from a view with gaps.
+	v := b.View(2, 0, 3, 3)
+	cp := v.Copy()
+	if !cp.Contiguous() || string(cp.Bytes()) != string(v.Bytes()) {
+		t.Errorf("Copy of a view has different cells")
+	}
+	small := NewBuffer(2, 2)
+	small.CopyFrom(v)
+	if small.At(0, 0) != 2 || small.At(1, 1) != 10 {
+		t.Errorf("CopyFrom a view copied the wrong cells: %v", small.Bytes())
+	}
+}
+
+func TestFieldCellsRoundTrip(t *testing.T) {
+	f := NewField(9, 5)
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 9; x++ {
+			f.Set(x, y, uint8(x*y%4))
+		}
+	}
+
+	// Cells is a copy, which can be changed without changing the field,
+	// and loaded into another field.
+	cells := f.Cells()
+	cells[0] = 3
+	if f.WhatIs(0, 0) != 0 {
+		t.Errorf("changing the cells from Cells changed the field")
+	}
+	cells[0] = 0
+	g := NewField(9, 5)
+	copy(g.Bytes(), cells)
+	if string(g.Bytes()) != string(f.Bytes()) {
+		t.Errorf("a field loaded from Cells has different cells")
+	}
+	if g.Count(3) != f.Count(3) || f.Count(3) == 0 {
+		t.Errorf("the fields have %d and %d cells of 3", f.Count(3), g.Count(3))
+	}
+}
+
+func TestFillAndCount(t *testing.T) {
+	b := NewBuffer(6, 6)
+	b.View(1, 1, 3, 2).Fill(5)
+	if b.Count(5) != 6 || b.Count(0) != 30 {
+		t.Errorf("filling a 3 x 2 view made %d cells of 5, want 6", b.Count(5))
+	}
+	if b.At(0, 0) != 0 || b.At(4, 1) != 0 || b.At(1, 3) != 0 {
+		t.Errorf("filling a view changed cells outside of it")
+	}
+}
+
+func TestZeroBuffer(t *testing.T) {
+	var b Buffer
+	if b.Width() != 0 || b.Height() != 0 || len(b.Bytes()) != 0 ||
+		b.Count(0) != 0 {
+		t.Errorf("the zero buffer isn't empty")
+	}
+	if v := b.View(0, 0, 5, 5); v.Width() != 0 || v.Height() != 0 {
+		t.Errorf("a view of the zero buffer isn't empty")
+	}
+	if n := NewBuffer(-3, 4); n.Width() != 0 || len(n.Bytes()) != 0 {
+		t.Errorf("a buffer with a negative width isn't empty")
+	}
+}
@@ -0,0 +1,240 @@
+/*
+Package engine is the shared part of every cellular automaton in fractalnet.
+
+A Field is a grid of cells, with one byte per cell, kept row by row in a
+single Buffer (see buffer.go).  A Rule decides the next value of a cell, by
+looking at the cell and its Neighborhood.  Step moves a whole Field forward
+by one generation, with any Rule.
+
+The automata themselves (the Game of War, the RGB games, Conway's Game of
+Life) are Rules, which are registered by name, so that a game can pick one.
+*/
+package engine
+
+// ===========================================================================
+//      Fields
+// ___________________________________________________________________________
+
+// Field represents a two-dimensional field of cells.
+type Field struct {
+	cells Buffer
+
+	// topology decides what is past the edges.  See topology.go.
+	topology string
+
+	// grid is the shape of the cells: squares or hexagons.  See hex.go.
+	grid string
+}
+
+// NewField returns an empty field of the specified width and height.
+func NewField(w, h int) *Field {
+	return &Field{cells: NewBuffer(w, h)}
+}
+
+// Width returns the number of cells in each row.
+func (f *Field) Width() int {
+	return f.cells.w
+}
+
+// Height returns the number of rows.
+func (f *Field) Height() int {
+	return f.cells.h
+}
+
+// Set sets the state of the specified cell to the given value.
+func (f *Field) Set(x, y int, b uint8) {
+	f.cells.Set(x, y, b)
+}
+
+// WhatIs reports the number that is at the specified cell.  Cells outside of
+// the field depend on its topology: on a bounded field, they are always 0.
+func (f *Field) WhatIs(x, y int) uint8 {
+	x, y, ok := Wrap(f.topology, x, y, f.cells.w, f.cells.h)
+	if !ok {
+		return 0
+	}
+	return f.cells.cells[y*f.cells.stride+x]
+}
+
+// Buffer returns the cells of the field.  It shares them with the field,
+// so changing the buffer changes the field.
+func (f *Field) Buffer() Buffer {
+	return f.cells
+}
+
+// Bytes returns the cells of the field, one byte per cell, row by row,
+// without copying them.  The slice is only good until the field changes,
+// so it should be used right away (like when it is encoded), or copied.
+func (f *Field) Bytes() []byte {
+	return f.cells.Bytes()
+}
+
+// Cells returns a copy of the field as an array of bytes, one per cell,
+// row by row.
+func (f *Field) Cells() []byte {
+	return f.cells.Copy().cells
+}
+
+// Count returns the number of cells with the given value.
+func (f *Field) Count(v uint8) int {
+	return f.cells.Count(v)
+}
+
+// ===========================================================================
+//      Neighborhoods
+// ___________________________________________________________________________
+
+// Offset is the position of a neighbor, relative to the cell in the middle.
+// On a hex field, it is in axial coordinates: see hex.go.
+type Offset struct {
+	X, Y int
+}
+
+// Moore is the neighborhood of the 4 cardinal directions and the 4
+// diagonals, for a total of 8 nearby cells.  The order matters: it is the
+// order used by the North, South, ... methods of Neighborhood.
+var Moore = []Offset{
+	{0, -1},  // North
+	{0, 1},   // South
+	{1, 0},   // East
+	{-1, 0},  // West
+	{1, -1},  // North-East
+	{-1, -1}, // North-West
+	{1, 1},   // South-East
+	{-1, 1},  // South-West
+}
+
+// MooreAndCross is the Moore neighborhood, plus the 4 cells that are 2
+// squares away in the cardinal directions.
+var MooreAndCross = append(append([]Offset{}, Moore...),
+	Offset{0, -2}, // North
+	Offset{0, 2},  // South
+	Offset{2, 0},  // East
+	Offset{-2, 0}, // West
+)
+
+// MAX_NEIGHBORS is the number of neighbors that fit in a Neighborhood
+// without using any more memory.  Rules with bigger neighborhoods still
+// work, but their cells are kept on the heap.
+const MAX_NEIGHBORS = 24
+
+// Neighborhood is what a Rule gets to look at: the value of the cell itself
+// (Me), and the values of its neighbors, in the order of the Rule's offsets.
+//
+// A single Neighborhood is reused for every cell of a generation, so asking
+// a rule about a cell doesn't allocate anything.  Rules shouldn't keep it
+// (or its Cells) after Next returns.
+type Neighborhood struct {
+	Me    uint8
+	Cells []uint8
+
+	// cells is where Cells is kept, as long as it fits.
+	cells [MAX_NEIGHBORS]uint8
+
+	// counts[v] is the number of neighbors with the value v.
+	counts [256]uint8
+}
+
+// load fills the neighborhood with the cell at (x,y) and its neighbors.
+func (n *Neighborhood) load(f *Field, x, y int, offsets []Offset) {
+	for _, v := range n.Cells {
+		n.counts[v] = 0
+	}
+	if n.Cells == nil {
+		n.Cells = n.cells[:0]
+	}
+	n.Cells = n.Cells[:0]
+	hex := f.grid == GRID_HEX
+	for _, o := range offsets {
+		ox, oy := x+o.X, y+o.Y
+		if hex {
+			ox, oy = HexMove(x, y, o.X, o.Y)
+		}
+		v := f.WhatIs(ox, oy)
+		n.Cells = append(n.Cells, v)
+		n.counts[v]++
+	}
+	n.Me = f.WhatIs(x, y)
+}
+
+// Count returns the number of neighbors with the given value.
+func (n *Neighborhood) Count(v uint8) int {
+	return int(n.counts[v])
+}
+
+// Alive returns the number of neighbors that aren't 0.
+func (n *Neighborhood) Alive() int {
+	return len(n.Cells) - n.Count(0)
+}
+
+// Most returns the value from lo to hi (inclusive) that the most neighbors
+// have, and how many of them have it.  If more than one value is tied for
+// the most, then unique is false.
+func (n *Neighborhood) Most(lo, hi uint8) (v uint8, count int, unique bool) {
+	for i := int(lo); i <= int(hi); i++ {
+		c := int(n.counts[i])
+		switch {
+		case i == int(lo) || c > count:
+			v, count, unique = uint8(i), c, true
+		case c == count:
+			unique = false
+		}
+	}
+	return v, count, unique
+}
+
+// The direction methods only make sense for Rules that start their offsets
+// with the Moore neighborhood.
+
+// North returns the value at coordinate (+0, -1) relative to center.
+func (n *Neighborhood) North() uint8 { return n.Cells[0] }
+
+// South returns the value at coordinate (+0, +1) relative to center.
+func (n *Neighborhood) South() uint8 { return n.Cells[1] }
+
+// East returns the value at coordinate (+1, +0) relative to center.
+func (n *Neighborhood) East() uint8 { return n.Cells[2] }
+
+// West returns the value at coordinate (-1, +0) relative to center.
+func (n *Neighborhood) West() uint8 { return n.Cells[3] }
+
+// NorthEast returns the value at coordinate (+1, -1) relative to center.
+func (n *Neighborhood) NorthEast() uint8 { return n.Cells[4] }
+
+// NorthWest returns the value at coordinate (-1, -1) relative to center.
+func (n *Neighborhood) NorthWest() uint8 { return n.Cells[5] }
+
+// SouthEast returns the value at coordinate (+1, +1) relative to center.
+func (n *Neighborhood) SouthEast() uint8 { return n.Cells[6] }
+
+// SouthWest returns the value at coordinate (-1, +1) relative to center.
+func (n *Neighborhood) SouthWest() uint8 { return n.Cells[7] }
+
+// ===========================================================================
+//      Stepping
+// ___________________________________________________________________________
+
+// Step writes the next generation of src into dst, by asking the rule about
+// every cell.  Both fields must have the same size.  If changed isn't nil,
+// then it is called for every cell that has a new value, row by row.
+func Step(rule Rule, src, dst *Field, changed func(x, y int)) {
+	stepRows(rule, rule.Neighbors(), src, dst, 0, src.Height(), changed)
+}
+
+// stepRows is Step, for the rows from y0 up to (but not including) y1.
+func stepRows(rule Rule, offsets []Offset, src, dst *Field, y0, y1 int,
+	changed func(x, y int)) {
+
+	n := &Neighborhood{}
+	for y := y0; y < y1; y++ {
+		row := dst.cells.Row(y)
+		for x := range row {
+			n.load(src, x, y, offsets)
+			next := rule.Next(n)
+			if changed != nil && next != n.Me {
+				changed(x, y)
+			}
+			row[x] = next
+		}
+	}
+}
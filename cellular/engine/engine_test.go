@@ -0,0 +1,165 @@
+package engine_test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/fractalbach/fractalnet/cellular/engine"
+
+	// These packages register the rest of the rules, so that every rule
+	// can be checked.
+	_ "github.com/fractalbach/fractalnet/cellular"
+	_ "github.com/fractalbach/fractalnet/cellular/gameofwar"
+	_ "github.com/fractalbach/fractalnet/cellular/wave"
+)
+
+var topologies = []string{
+	engine.TOPOLOGY_BOUNDED,
+	engine.TOPOLOGY_TORUS,
+	engine.TOPOLOGY_MIRROR,
+}
+
+// randomField returns a w*h field of random cells from 0 to states-1, for
+// the rule's grid.
+func randomField(rule engine.Rule, w, h, states int, seed int64) *engine.Field {
+	r := rand.New(rand.NewSource(seed))
+	f := engine.NewField(w, h)
+	f.SetGrid(engine.GridOf(rule))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			f.Set(x, y, uint8(r.Intn(states)))
+		}
+	}
+	return f
+}
+
+// copyField returns a new field with the same cells, topology and grid.
+func copyField(f *engine.Field) *engine.Field {
+	c := engine.NewField(f.Width(), f.Height())
+	c.SetTopology(f.Topology())
+	c.SetGrid(f.Grid())
+	c.Buffer().CopyFrom(f.Buffer())
+	return c
+}
+
+// stepper is one way of stepping a field.
+type stepper func(rule engine.Rule, src, dst *engine.Field,
+	changed func(x, y int))
+
+// run steps a copy of the field a few generations, and returns its cells
+// and the cells that changed, in the order that they were reported.
+func run(step stepper, rule engine.Rule, start *engine.Field,
+	generations int) ([]byte, []engine.Offset) {
+
+	src := copyField(start)
+	dst := copyField(start)
+	var changes []engine.Offset
+	for i := 0; i < generations; i++ {
+		step(rule, src, dst, func(x, y int) {
+			changes = append(changes, engine.Offset{x, y})
+		})
+		src, dst = dst, src
+	}
+	return src.Cells(), changes
+}
+
+func TestStepParallelMatchesStep(t *testing.T) {
+	const generations = 4
+	serial := stepper(engine.Step)
+	for _, workers := range []int{0, 2, 3, 7} {
+		parallel := func(rule engine.Rule, src, dst *engine.Field,
+			changed func(x, y int)) {
+			engine.StepParallel(rule, src, dst, changed, workers)
+		}
+		for _, name := range engine.Names() {
+			rule, err := engine.Lookup(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, topology := range topologies {
+				// The height isn't a multiple of the number of workers, so
+				// the bands have different sizes.
+				start := randomField(rule, 45, 4*engine.MIN_BAND_ROWS+6, 4, 1)
+				start.SetTopology(topology)
+				want, wantChanges := run(serial, rule, start, generations)
+				got, gotChanges := run(parallel, rule, start, generations)
+				where := fmt.Sprintf("%s on a %s field with %d workers",
+					name, topology, workers)
+				if !bytes.Equal(got, want) {
+					t.Errorf("%s: StepParallel's cells don't match Step's",
+						where)
+				}
+				if fmt.Sprint(gotChanges) != fmt.Sprint(wantChanges) {
+					t.Errorf("%s: StepParallel reported %d changes, and "+
+						"Step reported %d (or a different order)",
+						where, len(gotChanges), len(wantChanges))
+				}
+			}
+		}
+	}
+}
+
+// TestStepAllocations checks that stepping a field only allocates the one
+// neighborhood that it reuses for every cell, and nothing for each cell.
+// The wave and rgb rules used to make a map of colors for every cell.
+func TestStepAllocations(t *testing.T) {
+	for _, name := range engine.Names() {
+		rule, err := engine.Lookup(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := randomField(rule, 64, 64, 4, 1)
+		dst := copyField(src)
+		allocs := testing.AllocsPerRun(10, func() {
+			engine.Step(rule, src, dst, nil)
+			src, dst = dst, src
+		})
+		if allocs > 1 {
+			t.Errorf("a generation of %s on 64x64 made %v allocations, "+
+				"want at most 1", name, allocs)
+		}
+	}
+}
+
+// ===========================================================================
+//      Benchmarks
+// ___________________________________________________________________________
+
+/*
+Each benchmark steps a square field of random cells with Conway's rule, once
+per op, so ns/op is the time of a generation.  Run them with:
+
+        go test -bench . ./cellular/engine
+
+and pick the number of goroutines of StepParallel with -cpu, like -cpu 1,4.
+*/
+
+var benchSizes = []int{256, 1024, 2048}
+
+func benchmarkStep(b *testing.B, step stepper) {
+	for _, size := range benchSizes {
+		b.Run(fmt.Sprintf("%dx%d", size, size), func(b *testing.B) {
+			src := randomField(engine.Conway, size, size, 2, 1)
+			dst := engine.NewField(size, size)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				step(engine.Conway, src, dst, nil)
+				src, dst = dst, src
+			}
+		})
+	}
+}
+
+func BenchmarkStep(b *testing.B) {
+	benchmarkStep(b, engine.Step)
+}
+
+func BenchmarkStepParallel(b *testing.B) {
+	benchmarkStep(b, func(rule engine.Rule, src, dst *engine.Field,
+		changed func(x, y int)) {
+		engine.StepParallel(rule, src, dst, changed, 0)
+	})
+}
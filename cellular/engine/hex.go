@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"fmt"
+)
+
+// ===========================================================================
+//      Hexagonal Grids  ⬡
+// ___________________________________________________________________________
+
+/*
+A field can be a grid of squares, or a grid of hexagons.  The cells of a hex
+field are stored in the same rows and columns as a square field, but every
+odd row is pushed half a cell to the right ("odd-r" offset coordinates):
+
+        row 0      0   1   2   3
+        row 1        0   1   2   3
+        row 2      0   1   2   3
+
+The offsets of a hex Rule are in axial coordinates (q, r), which don't care
+whether the row is odd or even.  Going from (x,y) by the axial offset (q,r)
+means going r rows down, and q cells to the right along the row's diagonal.
+So (1,0) is always east, and (0,-1) is always north-west.
+
+On a torus, the height of a hex field should be even, or else the odd rows
+won't line up where the top and bottom edges meet.
+*/
+
+// The shapes of the cells in a field.
+const (
+	GRID_SQUARE = "square"
+	GRID_HEX    = "hex"
+)
+
+// The directions of the Hex neighborhood, which are also the indexes of
+// the neighbors in Neighborhood.Cells.
+const (
+	HEX_EAST = iota
+	HEX_NORTH_EAST
+	HEX_NORTH_WEST
+	HEX_WEST
+	HEX_SOUTH_WEST
+	HEX_SOUTH_EAST
+)
+
+// Hex is the neighborhood of the 6 hexagons that touch a hexagon, in axial
+// coordinates, in the order of the HEX_ directions.
+var Hex = []Offset{
+	{1, 0},  // East
+	{1, -1}, // North-East
+	{0, -1}, // North-West
+	{-1, 0}, // West
+	{-1, 1}, // South-West
+	{0, 1},  // South-East
+}
+
+// GridRule is a Rule that says which shape of grid it is meant for.  Rules
+// that don't implement it are for square grids.
+type GridRule interface {
+	Rule
+	Grid() string
+}
+
+// GridOf returns the shape of grid that the rule is meant for.
+func GridOf(rule Rule) string {
+	if g, ok := rule.(GridRule); ok {
+		return g.Grid()
+	}
+	return GRID_SQUARE
+}
+
+// HexMove returns the cell that is at the axial offset (q,r) from the cell
+// at (x,y) on a hex field.
+func HexMove(x, y, q, r int) (int, int) {
+	// Convert (x,y) into axial coordinates, move, and convert back.  The
+	// &1 picks the odd rows, even for negative rows.
+	aq := x - (y-(y&1))/2 + q
+	ar := y + r
+	return aq + (ar-(ar&1))/2, ar
+}
+
+// HexDistance returns the number of steps between two hexagons that are
+// the axial offset (q,r) apart.
+func HexDistance(q, r int) int {
+	return (abs(q) + abs(r) + abs(q+r)) / 2
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+// Grid returns the shape of the cells in the field.
+func (f *Field) Grid() string {
+	if f.grid == "" {
+		return GRID_SQUARE
+	}
+	return f.grid
+}
+
+// SetGrid changes the shape of the cells in the field.  The cells keep
+// their values; only their neighbors change.
+func (f *Field) SetGrid(g string) error {
+	switch g {
+	case "", GRID_SQUARE, GRID_HEX:
+		f.grid = g
+		return nil
+	}
+	return fmt.Errorf("there is no grid called %q; try %s or %s",
+		g, GRID_SQUARE, GRID_HEX)
+}
@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"testing"
+)
+
+func TestHexMove(t *testing.T) {
+	// The neighbors of a cell, in the order of the HEX_ directions.  Odd
+	// rows are pushed half a cell to the right, so the cells above and
+	// below an even row are at x-1 and x, and for an odd row, at x and x+1.
+	tests := []struct {
+		name string
+		x, y int
+		want [6]Offset
+	}{
+		{"even row", 2, 2, [6]Offset{
+			{3, 2}, {2, 1}, {1, 1}, {1, 2}, {1, 3}, {2, 3}}},
+		{"odd row", 2, 1, [6]Offset{
+			{3, 1}, {3, 0}, {2, 0}, {1, 1}, {2, 2}, {3, 2}}},
+		{"row 0", 0, 0, [6]Offset{
+			{1, 0}, {0, -1}, {-1, -1}, {-1, 0}, {-1, 1}, {0, 1}}},
+		{"odd negative row", 0, -1, [6]Offset{
+			{1, -1}, {1, -2}, {0, -2}, {-1, -1}, {0, 0}, {1, 0}}},
+		{"even negative row", 5, -4, [6]Offset{
+			{6, -4}, {5, -5}, {4, -5}, {4, -4}, {4, -3}, {5, -3}}},
+	}
+	for _, tt := range tests {
+		for dir, o := range Hex {
+			x, y := HexMove(tt.x, tt.y, o.X, o.Y)
+			if got := (Offset{x, y}); got != tt.want[dir] {
+				t.Errorf("%s: HexMove(%d, %d) by %v is %v, want %v",
+					tt.name, tt.x, tt.y, o, got, tt.want[dir])
+			}
+
+			// Going back the other way comes back to the same cell.
+			bx, by := HexMove(x, y, -o.X, -o.Y)
+			if bx != tt.x || by != tt.y {
+				t.Errorf("%s: going by %v and back ends at (%d, %d)",
+					tt.name, o, bx, by)
+			}
+		}
+	}
+}
+
+func TestHexDistance(t *testing.T) {
+	tests := []struct {
+		q, r, want int
+	}{
+		{0, 0, 0},
+		{1, 0, 1},
+		{1, -1, 1},
+		{-1, 1, 1},
+		{2, -1, 2},
+		{1, 1, 2},
+		{3, -3, 3},
+		{-2, -2, 4},
+	}
+	for _, tt := range tests {
+		if got := HexDistance(tt.q, tt.r); got != tt.want {
+			t.Errorf("HexDistance(%d, %d) = %d, want %d",
+				tt.q, tt.r, got, tt.want)
+		}
+	}
+	for _, o := range Hex {
+		if HexDistance(o.X, o.Y) != 1 {
+			t.Errorf("the hex neighbor %v isn't 1 step away", o)
+		}
+	}
+}
+
+func TestHexNeighborhood(t *testing.T) {
+	// Every cell of a 4x4 field is its own index, plus 1, so that the
+	// neighborhood shows which cells were read.
+	f := NewField(4, 4)
+	f.SetGrid(GRID_HEX)
+	for i := 0; i < 16; i++ {
+		f.Set(i%4, i/4, uint8(i+1))
+	}
+	at := func(x, y int) uint8 { return uint8(y*4 + x + 1) }
+	tests := []struct {
+		name     string
+		topology string
+		x, y     int
+		want     [6]uint8
+	}{
+		{"even row", TOPOLOGY_BOUNDED, 2, 2, [6]uint8{
+			at(3, 2), at(2, 1), at(1, 1), at(1, 2), at(1, 3), at(2, 3)}},
+		{"odd row", TOPOLOGY_BOUNDED, 1, 1, [6]uint8{
+			at(2, 1), at(2, 0), at(1, 0), at(0, 1), at(1, 2), at(2, 2)}},
+		{"corner", TOPOLOGY_BOUNDED, 0, 0, [6]uint8{
+			at(1, 0), 0, 0, 0, 0, at(0, 1)}},
+		{"odd row on the right edge", TOPOLOGY_BOUNDED, 3, 3, [6]uint8{
+			0, 0, at(3, 2), at(2, 3), 0, 0}},
+
+		// On a torus with an even height, the odd rows still line up
+		// where the top and bottom edges meet.
+		{"corner on a torus", TOPOLOGY_TORUS, 0, 0, [6]uint8{
+			at(1, 0), at(0, 3), at(3, 3), at(3, 0), at(3, 1), at(0, 1)}},
+		{"odd row on a torus", TOPOLOGY_TORUS, 3, 3, [6]uint8{
+			at(0, 3), at(0, 2), at(3, 2), at(2, 3), at(3, 0), at(0, 0)}},
+	}
+	n := &Neighborhood{}
+	for _, tt := range tests {
+		f.SetTopology(tt.topology)
+		n.load(f, tt.x, tt.y, Hex)
+		var got [6]uint8
+		copy(got[:], n.Cells)
+		if len(n.Cells) != 6 || got != tt.want {
+			t.Errorf("%s: the neighbors of (%d, %d) are %v, want %v",
+				tt.name, tt.x, tt.y, n.Cells, tt.want)
+		}
+	}
+}
+
+func TestHexRule(t *testing.T) {
+	// On a hex grid, a cell with 2 living neighbors is born, under B2/S34H,
+	// but only if they are hex neighbors: (1,0) is a neighbor of (1,1),
+	// which is an odd row, but (0,0) isn't.
+	rule := MustParseRule("B2/S34H")
+	if GridOf(rule) != GRID_HEX {
+		t.Fatalf("%s is for a %s grid", rule, GridOf(rule))
+	}
+	tests := []struct {
+		name   string
+		living [2]Offset
+		want   uint8
+	}{
+		{"hex neighbors", [2]Offset{{1, 0}, {2, 0}}, 1},
+		{"a square neighbor", [2]Offset{{0, 0}, {1, 0}}, 0},
+	}
+	for _, tt := range tests {
+		src := NewField(3, 3)
+		src.SetGrid(GRID_HEX)
+		for _, o := range tt.living {
+			src.Set(o.X, o.Y, 1)
+		}
+		dst := NewField(3, 3)
+		dst.SetGrid(GRID_HEX)
+		Step(rule, src, dst, nil)
+		if got := dst.WhatIs(1, 1); got != tt.want {
+			t.Errorf("%s: the cell at (1, 1) became %d, want %d",
+				tt.name, got, tt.want)
+		}
+	}
+}
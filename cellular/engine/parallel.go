@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"runtime"
+	"sync"
+)
+
+// ===========================================================================
+//      Stepping in Parallel
+// ___________________________________________________________________________
+
+/*
+On a big field, most of the time of a generation goes into asking the rule
+about every cell.  The cells don't depend on each other (they only read the
+old field, and each one writes its own cell of the new field), so the rows
+can be split into bands, and each band can be stepped by its own goroutine:
+
+        rows 0   - 255     worker 1
+        rows 256 - 511     worker 2
+        rows 512 - 767     worker 3
+        rows 768 - 1023    worker 4
+
+The new field is exactly the same as the one that Step makes.  The changed
+cells are collected by each band, and reported once every band is done, in
+the same order as Step reports them.
+*/
+
+// MIN_BAND_ROWS is the smallest number of rows that is worth giving to a
+// goroutine of its own.  Smaller fields are stepped on one goroutine.
+const MIN_BAND_ROWS = 32
+
+// StepParallel is like Step, but it splits the rows of the field between
+// up to workers goroutines.  If workers is 0 or less, then it is the number
+// of CPUs that Go is using (GOMAXPROCS).
+func StepParallel(rule Rule, src, dst *Field, changed func(x, y int),
+	workers int) {
+
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if bands := src.Height() / MIN_BAND_ROWS; workers > bands {
+		workers = bands
+	}
+	if workers <= 1 {
+		Step(rule, src, dst, changed)
+		return
+	}
+
+	offsets := rule.Neighbors()
+	changes := make([][]Offset, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		y0, y1 := src.Height()*i/workers, src.Height()*(i+1)/workers
+		var record func(x, y int)
+		if changed != nil {
+			band := &changes[i]
+			record = func(x, y int) {
+				*band = append(*band, Offset{x, y})
+			}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stepRows(rule, offsets, src, dst, y0, y1, record)
+		}()
+	}
+	wg.Wait()
+
+	if changed == nil {
+		return
+	}
+	for _, band := range changes {
+		for _, c := range band {
+			changed(c.X, c.Y)
+		}
+	}
+}
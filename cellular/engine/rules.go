@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ===========================================================================
+//      Rules
+// ___________________________________________________________________________
+
+// Rule is the transition function of a cellular automaton.
+type Rule interface {
+
+	// Neighbors returns the offsets of the cells that the rule looks at.
+	// The Neighborhood given to Next has their values in the same order.
+	Neighbors() []Offset
+
+	// Next returns the value of the cell in the next generation.  It is
+	// called from several goroutines at once by StepParallel, so it must
+	// not change anything.
+	Next(n *Neighborhood) uint8
+}
+
+var (
+	rulesMu sync.RWMutex
+	rules   = map[string]Rule{}
+)
+
+// Register makes a rule available by name.  It is meant to be called from
+// the init function of the package that has the rule.  Registering the same
+// name twice is a mistake, so it panics.
+func Register(name string, rule Rule) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	if rule == nil {
+		panic("engine: Register rule is nil")
+	}
+	if _, dup := rules[name]; dup {
+		panic("engine: Register called twice for rule " + name)
+	}
+	rules[name] = rule
+}
+
+// Lookup returns the rule that was registered with the given name.  If there
+// isn't one, then the name is parsed as a rulestring, like B3/S23.
+func Lookup(name string) (Rule, error) {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+	if rule, ok := rules[name]; ok {
+		return rule, nil
+	}
+	if strings.Contains(name, "/") {
+		rule, err := ParseRule(name)
+		if err != nil {
+			return nil, err
+		}
+		return rule, nil
+	}
+	return nil, fmt.Errorf("there is no rule called %q; try one of: %s, "+
+		"or a rulestring like B3/S23", name, strings.Join(namesLocked(), ", "))
+}
+
+// Names returns the names of every registered rule, sorted.
+func Names() []string {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+	return namesLocked()
+}
+
+func namesLocked() []string {
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+//      Conway's Game of Life
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+/*
+Conway is the rule of Conway's Game of Life.  Living cells are 1, and dead
+cells are 0.  Any value other than 0 counts as alive.
+
++-----------------------------------+
+|   Number    |   Currently Alive?  |
+|     of      |---------------------|
+|   Living    |----------+----------|
+|  Neighbors  |   Alive  |   Dead   |
+|===================================|
+|      2      |  Lives!  |          |
+|-------------+----------+----------|
+|      3      |  Lives!  |   Lives! |
+|-------------+----------+----------|
+|  Otherwise  |          |          |
++-------------+----------+----------+
+*/
+var Conway Rule = MustParseRule("B3/S23")
+
+func init() {
+	Register("conway", Conway)
+	Register("highlife", MustParseRule("B36/S23"))
+	Register("brain", MustParseRule("B2/S/C3"))
+	Register("hexlife", MustParseRule("B2/S34H"))
+}
@@ -0,0 +1,158 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+// copyRule is a rule where every cell becomes its east neighbor, so that
+// a field moves one cell to the left every generation.
+type copyRule struct{}
+
+var copyOffsets = []Offset{{1, 0}}
+
+func (copyRule) Neighbors() []Offset        { return copyOffsets }
+func (copyRule) Next(n *Neighborhood) uint8 { return n.Cells[0] }
+
+func TestLookup(t *testing.T) {
+	Register("test-copy", copyRule{})
+	tests := []struct {
+		name    string
+		want    string // the rulestring, or the type of the rule
+		wantErr string
+	}{
+		{"conway", "B3/S23", ""},
+		{"highlife", "B36/S23", ""},
+		{"brain", "B2/S/C3", ""},
+		{"hexlife", "B2/S34H", ""},
+		{"test-copy", "copyRule", ""},
+		{"B36/S23", "B36/S23", ""},
+		{"23/36", "B36/S23", ""},
+		{"B9/S23", "", "not a number of neighbors"},
+		{"nothing", "", "there is no rule called"},
+		{"", "", "there is no rule called"},
+	}
+	for _, tt := range tests {
+		rule, err := Lookup(tt.name)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Lookup(%q): got the error %v, want one about %q",
+					tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Lookup(%q): %v", tt.name, err)
+			continue
+		}
+		got := "copyRule"
+		if l, ok := rule.(*LifeLike); ok {
+			got = l.String()
+		}
+		if got != tt.want {
+			t.Errorf("Lookup(%q) is %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	found := false
+	for _, name := range Names() {
+		found = found || name == "test-copy"
+	}
+	if !found {
+		t.Errorf("Names doesn't have the registered rule: %v", Names())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("registering a rule twice didn't panic")
+		}
+	}()
+	Register("test-copy", copyRule{})
+}
+
+func TestStepWithRule(t *testing.T) {
+	f := NewField(4, 1)
+	f.Set(2, 0, 7)
+	dst := NewField(4, 1)
+	var changed []Offset
+	Step(copyRule{}, f, dst, func(x, y int) {
+		changed = append(changed, Offset{x, y})
+	})
+	if got := string(dst.Cells()); got != "\x00\x07\x00\x00" {
+		t.Errorf("the field after a step is %q, want the 7 one cell left",
+			got)
+	}
+	if len(changed) != 2 || changed[0] != (Offset{1, 0}) ||
+		changed[1] != (Offset{2, 0}) {
+		t.Errorf("the changed cells are %v, want [{1 0} {2 0}]", changed)
+	}
+}
+
+func TestConwayBlinker(t *testing.T) {
+	const (
+		across = "\x00\x00\x00\x00\x00" +
+			"\x00\x00\x00\x00\x00" +
+			"\x00\x01\x01\x01\x00" +
+			"\x00\x00\x00\x00\x00" +
+			"\x00\x00\x00\x00\x00"
+		down = "\x00\x00\x00\x00\x00" +
+			"\x00\x00\x01\x00\x00" +
+			"\x00\x00\x01\x00\x00" +
+			"\x00\x00\x01\x00\x00" +
+			"\x00\x00\x00\x00\x00"
+	)
+	src, dst := NewField(5, 5), NewField(5, 5)
+	for x := 1; x <= 3; x++ {
+		src.Set(x, 2, 1)
+	}
+	for i, want := range []string{down, across, down} {
+		Step(Conway, src, dst, nil)
+		if got := string(dst.Cells()); got != want {
+			t.Fatalf("generation %d is %q, want %q", i+1, got, want)
+		}
+		src, dst = dst, src
+	}
+}
+
+func TestNeighborhoodCounts(t *testing.T) {
+	f := NewField(3, 3)
+	for i, v := range []uint8{1, 2, 2, 0, 9, 3, 3, 2, 1} {
+		f.Set(i%3, i/3, v)
+	}
+	n := &Neighborhood{}
+	n.load(f, 1, 1, Moore)
+	if n.Me != 9 || len(n.Cells) != 8 {
+		t.Fatalf("the neighborhood is %d with %d neighbors, want 9 with 8",
+			n.Me, len(n.Cells))
+	}
+	if n.Count(2) != 3 || n.Count(9) != 0 || n.Alive() != 7 {
+		t.Errorf("Count(2) = %d, Count(9) = %d, Alive() = %d; want 3, 0, 7",
+			n.Count(2), n.Count(9), n.Alive())
+	}
+	if n.North() != 2 || n.South() != 2 || n.East() != 3 || n.West() != 0 {
+		t.Errorf("N, S, E, W are %d, %d, %d, %d; want 2, 2, 3, 0",
+			n.North(), n.South(), n.East(), n.West())
+	}
+	if v, c, unique := n.Most(1, 3); v != 2 || c != 3 || !unique {
+		t.Errorf("Most(1, 3) = %d, %d, %v; want 2, 3, true", v, c, unique)
+	}
+	if _, _, unique := n.Most(1, 1); !unique {
+		t.Errorf("Most(1, 1) isn't unique")
+	}
+	if v, c, unique := n.Most(0, 1); v != 1 || c != 2 || !unique {
+		t.Errorf("Most(0, 1) = %d, %d, %v; want 1, 2, true", v, c, unique)
+	}
+
+	// Loading another cell forgets the counts of the last one.
+	n.load(f, 0, 0, Moore)
+	if n.Count(3) != 0 || n.Count(9) != 1 || n.Alive() != 2 {
+		t.Errorf("after loading (0,0): Count(3) = %d, Count(9) = %d, "+
+			"Alive() = %d; want 0, 1, 2", n.Count(3), n.Count(9), n.Alive())
+	}
+	if v, c, unique := n.Most(1, 2); v != 2 || c != 1 || !unique {
+		t.Errorf("Most(1, 2) = %d, %d, %v; want 2, 1, true", v, c, unique)
+	}
+	if _, c, unique := n.Most(3, 4); c != 0 || unique {
+		t.Errorf("Most(3, 4) of a tie at 0 is %d, unique %v", c, unique)
+	}
+}
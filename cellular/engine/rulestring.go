@@ -0,0 +1,200 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ===========================================================================
+//      Life-like & Generations Rulestrings
+// ___________________________________________________________________________
+
+/*
+A rulestring describes a Life-like rule without any Go code: the numbers of
+living neighbors that give birth to a dead cell, and the numbers that let a
+living cell survive.  These are all the same rule (Conway's Game of Life):
+
+        B3/S23          birth first, then survival
+        S23/B3          the letters can come in either order
+        23/3            without letters, survival comes first
+
+Generations rules add a number of states.  A living cell that doesn't
+survive starts dying: it goes through the states 2, 3, ... until it is dead
+again, and dying cells don't count as living neighbors.  Brian's Brain is:
+
+        B2/S/C3         with letters
+        /2/3            without letters: survival/birth/states
+
+A rule with 2 states is an ordinary Life-like rule, where every value other
+than 0 is alive.  Neighbors are the 8 cells of the Moore neighborhood, unless
+the rulestring ends with an H, like B2/S34H.  Then the rule is for a hex
+grid, and the neighbors are the 6 cells of the Hex neighborhood.
+*/
+
+// MAX_GENERATIONS_STATES is the most states that a Generations rule can have.
+const MAX_GENERATIONS_STATES = 256
+
+// LifeLike is a rule that was parsed from a rulestring.
+type LifeLike struct {
+
+	// Birth[n] is true if a dead cell with n living neighbors is born.
+	Birth [9]bool
+
+	// Survive[n] is true if a living cell with n living neighbors survives.
+	Survive [9]bool
+
+	// States is the number of states, counting dead and alive.  It is 2 for
+	// an ordinary Life-like rule.
+	States int
+
+	// Hex is true for a rule on a hex grid.
+	Hex bool
+}
+
+// ParseRule reads a Life-like or Generations rulestring.
+func ParseRule(s string) (*LifeLike, error) {
+	r := &LifeLike{States: 2}
+	body := strings.TrimSpace(s)
+	if strings.HasSuffix(body, "H") || strings.HasSuffix(body, "h") {
+		r.Hex = true
+		body = body[:len(body)-1]
+	}
+	parts := strings.Split(body, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, fmt.Errorf("%q is not a rulestring like B3/S23", s)
+	}
+
+	// With letters, the parts can come in any order.  Without them, the
+	// order is survival/birth/states.
+	seen := map[byte]bool{}
+	for i, part := range parts {
+		kind := "SBC"[i]
+		if part != "" && strings.ContainsRune("BSCbsc", rune(part[0])) {
+			kind = strings.ToUpper(part)[0]
+			part = part[1:]
+		}
+		if seen[kind] {
+			return nil, fmt.Errorf("%q has more than one %c part", s, kind)
+		}
+		seen[kind] = true
+
+		var err error
+		switch kind {
+		case 'B':
+			err = parseCounts(&r.Birth, part)
+		case 'S':
+			err = parseCounts(&r.Survive, part)
+		case 'C':
+			r.States, err = strconv.Atoi(part)
+			if err != nil {
+				err = fmt.Errorf("%q is not a number of states", part)
+			} else if r.States < 2 || r.States > MAX_GENERATIONS_STATES {
+				err = fmt.Errorf("the number of states must be between 2 and %d",
+					MAX_GENERATIONS_STATES)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", s, err)
+		}
+	}
+	if !seen['B'] || !seen['S'] {
+		return nil, fmt.Errorf("%q needs both a B part and an S part", s)
+	}
+	if r.Hex && (r.Birth[7] || r.Birth[8] || r.Survive[7] || r.Survive[8]) {
+		return nil, fmt.Errorf("%q: a hexagon only has 6 neighbors", s)
+	}
+	return r, nil
+}
+
+// MustParseRule is like ParseRule, but it panics if the rulestring is bad.
+func MustParseRule(s string) *LifeLike {
+	r, err := ParseRule(s)
+	if err != nil {
+		panic("engine: " + err.Error())
+	}
+	return r
+}
+
+// parseCounts sets counts[n] for every digit n in the string.
+func parseCounts(counts *[9]bool, digits string) error {
+	for _, c := range digits {
+		if c < '0' || c > '8' {
+			return fmt.Errorf("%q is not a number of neighbors (0 to 8)", c)
+		}
+		if counts[c-'0'] {
+			return fmt.Errorf("%c is there twice", c)
+		}
+		counts[c-'0'] = true
+	}
+	return nil
+}
+
+// String returns the rulestring in its usual form, like B3/S23 or B2/S/C3.
+func (r *LifeLike) String() string {
+	var b strings.Builder
+	b.WriteByte('B')
+	writeCounts(&b, &r.Birth)
+	b.WriteString("/S")
+	writeCounts(&b, &r.Survive)
+	if r.States > 2 {
+		fmt.Fprintf(&b, "/C%d", r.States)
+	}
+	if r.Hex {
+		b.WriteByte('H')
+	}
+	return b.String()
+}
+
+func writeCounts(b *strings.Builder, counts *[9]bool) {
+	for n, ok := range counts {
+		if ok {
+			b.WriteByte(byte('0' + n))
+		}
+	}
+}
+
+func (r *LifeLike) Neighbors() []Offset {
+	if r.Hex {
+		return Hex
+	}
+	return Moore
+}
+
+// Grid returns the shape of grid that the rule is for.
+func (r *LifeLike) Grid() string {
+	if r.Hex {
+		return GRID_HEX
+	}
+	return GRID_SQUARE
+}
+
+// Next returns the state of the cell at the next time step.
+func (r *LifeLike) Next(n *Neighborhood) uint8 {
+	if r.States <= 2 {
+		c := n.Alive()
+		if n.Me == 0 {
+			return boolToCell(r.Birth[c])
+		}
+		return boolToCell(r.Survive[c])
+	}
+
+	// Generations: only the cells in state 1 are alive.
+	c := n.Count(1)
+	switch {
+	case n.Me == 0:
+		return boolToCell(r.Birth[c])
+	case n.Me == 1 && r.Survive[c]:
+		return 1
+	case int(n.Me)+1 < r.States:
+		return n.Me + 1
+	}
+	return 0
+}
+
+func boolToCell(alive bool) uint8 {
+	if alive {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string // the rule, as String writes it
+		wantErr string
+	}{
+		// Conway's Game of Life, in every form.
+		{"B3/S23", "B3/S23", ""},
+		{"S23/B3", "B3/S23", ""},
+		{"23/3", "B3/S23", ""},
+		{"b3/s23", "B3/S23", ""},
+		{"  B3/S23\n", "B3/S23", ""},
+
+		{"B36/S23", "B36/S23", ""},
+		{"B/S012345678", "B/S012345678", ""},
+		{"B0/S8", "B0/S8", ""},
+
+		// Generations.
+		{"B2/S/C3", "B2/S/C3", ""},
+		{"/2/3", "B2/S/C3", ""},
+		{"C3/B2/S", "B2/S/C3", ""},
+		{"B2/S/C2", "B2/S", ""},
+		{"B2/S/C256", "B2/S/C256", ""},
+
+		// Hex grids.
+		{"B2/S34H", "B2/S34H", ""},
+		{"B2/S34h", "B2/S34H", ""},
+
+		// Malformed.
+		{"", "", "not a rulestring"},
+		{"B3", "", "not a rulestring"},
+		{"B3/S23/C3/H", "", "not a rulestring"},
+		{"B3/B3", "", "more than one B"},
+		{"B3/C3", "", "needs both"},
+		{"B3x/S23", "", "not a number of neighbors"},
+		{"B33/S23", "", "there twice"},
+		{"B3/S23/Cx", "", "not a number of states"},
+		{"conway", "", "not a rulestring"},
+
+		// Out of range.
+		{"B9/S23", "", "not a number of neighbors"},
+		{"B3/S-1", "", "not a number of neighbors"},
+		{"B2/S/C1", "", "between 2 and 256"},
+		{"B2/S/C257", "", "between 2 and 256"},
+		{"B2/S/C-3", "", "between 2 and 256"},
+		{"B27/S34H", "", "only has 6 neighbors"},
+		{"B2/S348H", "", "only has 6 neighbors"},
+	}
+	for _, tt := range tests {
+		r, err := ParseRule(tt.in)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseRule(%q): got the error %v, want one about %q",
+					tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseRule(%q): %v", tt.in, err)
+			continue
+		}
+		if r.String() != tt.want {
+			t.Errorf("ParseRule(%q) is %s, want %s", tt.in, r, tt.want)
+		}
+
+		// Its String reads back as the same rule.
+		again, err := ParseRule(r.String())
+		if err != nil || *again != *r {
+			t.Errorf("ParseRule(%q) doesn't read back the same: %v", r, err)
+		}
+	}
+}
+
+func TestLifeLikeNext(t *testing.T) {
+	// next returns the next state of a cell with the value me, and alive
+	// neighbors of state 1.
+	next := func(r *LifeLike, me uint8, alive int) uint8 {
+		f := NewField(3, 3)
+		f.Set(1, 1, me)
+		for _, o := range Moore[:alive] {
+			f.Set(1+o.X, 1+o.Y, 1)
+		}
+		n := &Neighborhood{}
+		n.load(f, 1, 1, r.Neighbors())
+		return r.Next(n)
+	}
+	tests := []struct {
+		rule  string
+		me    uint8
+		alive int
+		want  uint8
+	}{
+		{"B3/S23", 0, 3, 1},
+		{"B3/S23", 0, 2, 0},
+		{"B3/S23", 1, 2, 1},
+		{"B3/S23", 1, 4, 0},
+		{"B3/S23", 7, 3, 1}, // any value but 0 is alive
+		{"B36/S23", 0, 6, 1},
+
+		// Brian's Brain: living cells always start dying, and dying cells
+		// die.
+		{"B2/S/C3", 0, 2, 1},
+		{"B2/S/C3", 1, 2, 2},
+		{"B2/S/C3", 2, 2, 0},
+
+		// Star Wars: cells go through 2 dying states.
+		{"B2/S345/C4", 1, 3, 1},
+		{"B2/S345/C4", 1, 1, 2},
+		{"B2/S345/C4", 2, 1, 3},
+		{"B2/S345/C4", 3, 1, 0},
+	}
+	for _, tt := range tests {
+		r := MustParseRule(tt.rule)
+		if got := next(r, tt.me, tt.alive); got != tt.want {
+			t.Errorf("%s: a cell of %d with %d living neighbors becomes %d, "+
+				"want %d", tt.rule, tt.me, tt.alive, got, tt.want)
+		}
+	}
+}
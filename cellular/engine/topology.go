@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"fmt"
+)
+
+// ===========================================================================
+//      Topology: What Happens at the Edges
+// ___________________________________________________________________________
+
+/*
+The topology of a field decides what a cell sees when it looks past the edge:
+
+        bounded    Nothing.  Every cell past the edge is dead (always 0).
+        torus      The other side.  The field wraps around, left to right and
+                   top to bottom, like the surface of a donut.
+        mirror     Itself.  The edge is a mirror, so the cell 1 past the edge
+                   is the cell on the edge, and 2 past is the one next to it.
+
+Changes past the edge land on the same cell that would be read there: on a
+torus, changing a cell past the right edge changes a cell near the left
+edge, and on a mirror, it changes the cell that it is a reflection of.  On a
+bounded field, changes past the edge are thrown away.
+*/
+
+// The topologies that a field can have.
+const (
+	TOPOLOGY_BOUNDED = "bounded"
+	TOPOLOGY_TORUS   = "torus"
+	TOPOLOGY_MIRROR  = "mirror"
+)
+
+// ValidTopology returns an error if t isn't one of the topologies.  The
+// empty string is the same as TOPOLOGY_BOUNDED.
+func ValidTopology(t string) error {
+	switch t {
+	case "", TOPOLOGY_BOUNDED, TOPOLOGY_TORUS, TOPOLOGY_MIRROR:
+		return nil
+	}
+	return fmt.Errorf("there is no topology called %q; try one of: %s, %s, %s",
+		t, TOPOLOGY_BOUNDED, TOPOLOGY_TORUS, TOPOLOGY_MIRROR)
+}
+
+// Wrap moves the coordinate (x,y) onto a field of size w*h, for reading.
+// It returns false if there is no cell to read there, which only happens
+// on a bounded field.
+func Wrap(topology string, x, y, w, h int) (int, int, bool) {
+	if x >= 0 && y >= 0 && x < w && y < h {
+		return x, y, true
+	}
+	switch topology {
+	case TOPOLOGY_TORUS:
+		return wrapTorus(x, w), wrapTorus(y, h), true
+	case TOPOLOGY_MIRROR:
+		return wrapMirror(x, w), wrapMirror(y, h), true
+	}
+	return x, y, false
+}
+
+// WrapWrite is like Wrap, but for changing a cell.  It returns false if a
+// change at (x,y) should be thrown away.  A change goes to the cell that is
+// read at (x,y), so that a pattern stamped across the edge of a mirror is
+// reflected, just like the cells see it.
+func WrapWrite(topology string, x, y, w, h int) (int, int, bool) {
+	return Wrap(topology, x, y, w, h)
+}
+
+func wrapTorus(i, n int) int {
+	i %= n
+	if i < 0 {
+		i += n
+	}
+	return i
+}
+
+// wrapMirror reflects i back into [0, n).  The pattern repeats every 2n
+// cells: 0, 1, ... n-1, n-1, ... 1, 0.
+func wrapMirror(i, n int) int {
+	i = wrapTorus(i, 2*n)
+	if i >= n {
+		i = 2*n - 1 - i
+	}
+	return i
+}
+
+// Topology returns the topology of the field.
+func (f *Field) Topology() string {
+	if f.topology == "" {
+		return TOPOLOGY_BOUNDED
+	}
+	return f.topology
+}
+
+// SetTopology changes what the cells on the edge see past the edge.
+func (f *Field) SetTopology(t string) error {
+	if err := ValidTopology(t); err != nil {
+		return err
+	}
+	f.topology = t
+	return nil
+}
+
+// Wrap moves the coordinate (x,y) onto the field, for changing a cell.  It
+// returns false if a change at (x,y) should be thrown away.
+func (f *Field) Wrap(x, y int) (int, int, bool) {
+	return WrapWrite(f.topology, x, y, f.cells.w, f.cells.h)
+}
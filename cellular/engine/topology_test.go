@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	const w, h = 5, 3
+	tests := []struct {
+		topology     string
+		x, y         int
+		wantX, wantY int
+		wantOk       bool
+	}{
+		// Inside of the field, every topology is the same.
+		{TOPOLOGY_BOUNDED, 0, 0, 0, 0, true},
+		{TOPOLOGY_BOUNDED, 4, 2, 4, 2, true},
+		{TOPOLOGY_TORUS, 3, 1, 3, 1, true},
+		{TOPOLOGY_MIRROR, 3, 1, 3, 1, true},
+		{"", 2, 2, 2, 2, true},
+
+		// Bounded: there is nothing past the edge.
+		{TOPOLOGY_BOUNDED, -1, 0, -1, 0, false},
+		{TOPOLOGY_BOUNDED, 5, 0, 5, 0, false},
+		{TOPOLOGY_BOUNDED, 0, -1, 0, -1, false},
+		{TOPOLOGY_BOUNDED, 0, 3, 0, 3, false},
+		{"", 5, 3, 5, 3, false},
+
+		// Torus: the other side.
+		{TOPOLOGY_TORUS, -1, 0, 4, 0, true},
+		{TOPOLOGY_TORUS, 5, 0, 0, 0, true},
+		{TOPOLOGY_TORUS, 0, -1, 0, 2, true},
+		{TOPOLOGY_TORUS, 0, 3, 0, 0, true},
+		{TOPOLOGY_TORUS, -1, -1, 4, 2, true},
+		{TOPOLOGY_TORUS, 12, -7, 2, 2, true},
+		{TOPOLOGY_TORUS, -11, 9, 4, 0, true},
+
+		// Mirror: 1 past the edge is the edge, 2 past is next to it.
+		{TOPOLOGY_MIRROR, -1, 0, 0, 0, true},
+		{TOPOLOGY_MIRROR, -2, 0, 1, 0, true},
+		{TOPOLOGY_MIRROR, 5, 0, 4, 0, true},
+		{TOPOLOGY_MIRROR, 6, 0, 3, 0, true},
+		{TOPOLOGY_MIRROR, 0, -1, 0, 0, true},
+		{TOPOLOGY_MIRROR, 0, 3, 0, 2, true},
+		{TOPOLOGY_MIRROR, 0, 4, 0, 1, true},
+		{TOPOLOGY_MIRROR, 10, 6, 0, 0, true},
+		{TOPOLOGY_MIRROR, -6, -4, 4, 2, true},
+	}
+	for _, tt := range tests {
+		x, y, ok := Wrap(tt.topology, tt.x, tt.y, w, h)
+		if ok != tt.wantOk || (ok && (x != tt.wantX || y != tt.wantY)) {
+			t.Errorf("Wrap(%q, %d, %d) on %dx%d = (%d, %d, %v), "+
+				"want (%d, %d, %v)", tt.topology, tt.x, tt.y, w, h,
+				x, y, ok, tt.wantX, tt.wantY, tt.wantOk)
+		}
+	}
+}
+
+func TestWrapWrite(t *testing.T) {
+	tests := []struct {
+		topology string
+		x, y     int
+		wantX    int
+		wantY    int
+		wantOk   bool
+	}{
+		{TOPOLOGY_BOUNDED, 2, 2, 2, 2, true},
+		{TOPOLOGY_BOUNDED, -1, 0, -1, 0, false},
+		{TOPOLOGY_TORUS, -1, 0, 2, 0, true},
+		{TOPOLOGY_MIRROR, 2, 2, 2, 2, true},
+		// A change past the edge of a mirror is reflected.
+		{TOPOLOGY_MIRROR, -1, 0, 0, 0, true},
+		{TOPOLOGY_MIRROR, 0, 3, 0, 2, true},
+		{TOPOLOGY_MIRROR, 4, -2, 1, 1, true},
+	}
+	for _, tt := range tests {
+		x, y, ok := WrapWrite(tt.topology, tt.x, tt.y, 3, 3)
+		if ok != tt.wantOk || ok && (x != tt.wantX || y != tt.wantY) {
+			t.Errorf("WrapWrite(%q, %d, %d) is (%d, %d, %v), "+
+				"want (%d, %d, %v)", tt.topology, tt.x, tt.y,
+				x, y, ok, tt.wantX, tt.wantY, tt.wantOk)
+		}
+	}
+}
+
+func TestFieldTopology(t *testing.T) {
+	f := NewField(4, 4)
+	f.Set(0, 0, 1)
+	f.Set(3, 3, 2)
+	tests := []struct {
+		topology string
+		x, y     int
+		want     uint8
+	}{
+		{TOPOLOGY_BOUNDED, -1, -1, 0},
+		{TOPOLOGY_TORUS, -1, -1, 2},
+		{TOPOLOGY_TORUS, 4, 4, 1},
+		{TOPOLOGY_MIRROR, -1, -1, 1},
+		{TOPOLOGY_MIRROR, 4, 4, 2},
+	}
+	for _, tt := range tests {
+		if err := f.SetTopology(tt.topology); err != nil {
+			t.Fatal(err)
+		}
+		if got := f.WhatIs(tt.x, tt.y); got != tt.want {
+			t.Errorf("%s: WhatIs(%d, %d) = %d, want %d",
+				tt.topology, tt.x, tt.y, got, tt.want)
+		}
+	}
+	if err := f.SetTopology("klein bottle"); err == nil {
+		t.Errorf("SetTopology accepted a topology that doesn't exist")
+	}
+	if f.Topology() != TOPOLOGY_MIRROR {
+		t.Errorf("a bad topology changed the field's topology to %q",
+			f.Topology())
+	}
+}
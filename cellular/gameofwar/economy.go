@@ -0,0 +1,162 @@
+package gameofwar
+
+import (
+	"errors"
+)
+
+// ===========================================================================
+//      Resources & Bomb Cooldowns  💰 💣
+// ___________________________________________________________________________
+
+/*
+Each team has a pool of resources, which fills up a little bit with every
+generation of a running round, and a bit faster for teams that hold more
+territory.  Dropping a bomb costs resources, and then the team has to wait
+for its bombs to cool down before it can drop another one.  Placing a
+pattern is paid for by its living cells, and cools down just like a bomb.
+
+Since both of these are counted in generations, nothing refills or cools
+down while the game is paused, or outside of a running round.
+*/
+
+// The reasons that a team can't drop a bomb, or place a pattern.
+var (
+	ErrBombCooldown       = errors.New("Your team's bombs are cooling down.")
+	ErrNotEnoughResources = errors.New("Your team can't afford a bomb.")
+	ErrPatternTooDear     = errors.New("Your team can't afford that pattern.")
+	ErrRoundNotRunning    = errors.New("Patterns can only be placed while " +
+		"the round is running.")
+)
+
+// Economy holds the prices and the rates of the resource economy.
+type Economy struct {
+
+	// StartResources is what each team has at the start of a round.
+	StartResources int
+
+	// MaxResources is the most that a team can save up.
+	MaxResources int
+
+	// Income is added to each team's resources after every generation.
+	Income int
+
+	// SquaresPerIncome gives each team 1 more resource per generation for
+	// every SquaresPerIncome squares of territory that it holds.  0 turns
+	// it off.
+	SquaresPerIncome int
+
+	// BombCost is the price of a single bomb.
+	BombCost int
+
+	// BombCooldown is the number of generations that a team has to wait
+	// after dropping a bomb (or placing a pattern), before it can drop
+	// another one.
+	BombCooldown int
+
+	// CellCost is the price of each living cell of a pattern.
+	CellCost int
+}
+
+// TeamBudget is what a team has left to spend.  Cooldown is the number of
+// generations until the team can drop its next bomb.
+type TeamBudget struct {
+	Resources int
+	Cooldown  int
+}
+
+// Budgets holds the TeamBudget of each team.
+type Budgets struct {
+	Team1 TeamBudget
+	Team2 TeamBudget
+}
+
+// team returns the budget of the given team, or nil if it isn't a team.
+func (b *Budgets) team(t uint8) *TeamBudget {
+	switch t {
+	case TEAM_1:
+		return &b.Team1
+	case TEAM_2:
+		return &b.Team2
+	}
+	return nil
+}
+
+// SetEconomy changes the prices and rates of the economy, and fills up both
+// teams with the starting resources.
+func (g *GameInstance) SetEconomy(e Economy) {
+	g.economy = e
+	g.resetBudgets()
+}
+
+// Economy returns the prices and rates of the economy.
+func (g *GameInstance) Economy() Economy {
+	return g.economy
+}
+
+// Budgets returns what each team has left to spend.
+func (g *GameInstance) Budgets() Budgets {
+	return g.budgets
+}
+
+// LoadBudgets restores the budgets, as returned by Budgets.
+func (g *GameInstance) LoadBudgets(b Budgets) {
+	g.budgets = b
+}
+
+// resetBudgets gives both teams the starting resources, and no cooldown.
+func (g *GameInstance) resetBudgets() {
+	start := TeamBudget{Resources: g.economy.StartResources}
+	g.budgets = Budgets{Team1: start, Team2: start}
+}
+
+// payForBomb takes the price of a bomb from the team, and starts the
+// cooldown.  If the team can't drop a bomb, nothing is taken and the reason
+// is returned.
+func (g *GameInstance) payForBomb(team uint8) error {
+	return g.pay(team, g.economy.BombCost, ErrNotEnoughResources)
+}
+
+// payForPattern is like payForBomb, but for a pattern with the given number
+// of living cells.
+func (g *GameInstance) payForPattern(team uint8, cells int) error {
+	return g.pay(team, cells*g.economy.CellCost, ErrPatternTooDear)
+}
+
+// pay takes the cost from the team, and starts the cooldown.  If the team
+// can't afford it, then the broke error is returned.
+func (g *GameInstance) pay(team uint8, cost int, broke error) error {
+	b := g.budgets.team(team)
+	if b == nil {
+		return nil
+	}
+	if b.Cooldown > 0 {
+		return ErrBombCooldown
+	}
+	if b.Resources < cost {
+		return broke
+	}
+	b.Resources -= cost
+	b.Cooldown = g.economy.BombCooldown
+	return nil
+}
+
+// earn pays each team its income for one generation, and counts down the
+// cooldowns.  The score is the territory that each team holds.
+func (g *GameInstance) earn(s Score) {
+	e := g.economy
+	g.budgets.Team1.earn(e, s.Team1)
+	g.budgets.Team2.earn(e, s.Team2)
+}
+
+func (b *TeamBudget) earn(e Economy, territory int) {
+	b.Resources += e.Income
+	if e.SquaresPerIncome > 0 {
+		b.Resources += territory / e.SquaresPerIncome
+	}
+	if b.Resources > e.MaxResources {
+		b.Resources = e.MaxResources
+	}
+	if b.Cooldown > 0 {
+		b.Cooldown--
+	}
+}
@@ -0,0 +1,111 @@
+package gameofwar
+
+import (
+	"github.com/fractalbach/fractalnet/cellular/engine"
+)
+
+// ===========================================================================
+//      Hex Game of War  ⬡
+// ___________________________________________________________________________
+
+/*
+The Game of War on a grid of hexagons.  Each hexagon only has 6 neighbors,
+and there is no straight north or south, so the teams push along the
+diagonals instead:
+
+        Team 2 comes from the top:      north-east, north-west
+        Team 1 comes from the bottom:   south-east, south-west
+        Both teams, from the sides:     east, west
+
+Like the square game, an empty hexagon goes to the team with more points,
+and turns into fallout (7) if there is a tie.  Bombs burn out the same way.
+*/
+
+// HEX_RULE is the name of the hex Game of War rule.
+const HEX_RULE = "hexwar"
+
+// hexWarRule is the rule of the Game of War on a hex grid.
+type hexWarRule struct{}
+
+func (hexWarRule) Neighbors() []engine.Offset {
+	return engine.Hex
+}
+
+func (hexWarRule) Grid() string {
+	return engine.GRID_HEX
+}
+
+// Next returns the state of the cell at the next time step.
+func (hexWarRule) Next(n *engine.Neighborhood) uint8 {
+	me := n.Me
+
+	if me >= 7 {
+		return 0
+	}
+	if me >= 3 {
+		return me + 1
+	}
+	if me != 0 {
+		return me
+	}
+
+	points1, points2 := 0, 0
+	for dir, v := range n.Cells {
+		switch dir {
+		case engine.HEX_NORTH_EAST, engine.HEX_NORTH_WEST:
+			if v == TEAM_2 {
+				points2++
+			}
+		case engine.HEX_SOUTH_EAST, engine.HEX_SOUTH_WEST:
+			if v == TEAM_1 {
+				points1++
+			}
+		case engine.HEX_EAST, engine.HEX_WEST:
+			switch v {
+			case TEAM_1:
+				points1++
+			case TEAM_2:
+				points2++
+			}
+		}
+	}
+
+	switch {
+	case points1 > points2:
+		return TEAM_1
+	case points1 < points2:
+		return TEAM_2
+	}
+	return 7
+}
+
+func init() {
+	engine.Register(HEX_RULE, hexWarRule{})
+}
+
+/*
+doLaBombaHex is La Bomba for a hex grid.  It changes every hexagon within
+2 steps of (x,y): a total of 19 hexagons.
+
+             o o o
+            o + + o
+           o + @ + o
+            o + + o
+             o o o
+
+        o = 3
+        + = 4
+        @ = 5
+*/
+func (l *Life) doLaBombaHex(x, y int) {
+	for r := -2; r <= 2; r++ {
+		for q := -2; q <= 2; q++ {
+			d := engine.HexDistance(q, r)
+			if d > 2 {
+				continue
+			}
+			hx, hy := engine.HexMove(x, y, q, r)
+			l.AlterAt(hx, hy, uint8(5-d))
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package gameofwar
+
+import (
+	"math"
+)
+
+// ===========================================================================
+//      Rounds, Scores & Winning
+// ___________________________________________________________________________
+
+/*
+A round of the Game of War goes through 3 phases:
+
+        Lobby      The teams set up their squares, and then somebody
+                   starts the round.
+        Running    The teams earn resources, and the victory conditions
+                   are checked after every generation.
+        Finished   Somebody has won (or it's a draw), until a fresh game
+                   goes back to the lobby.
+
+The board keeps moving on every tick in all 3 phases (unless the game is
+paused); the phase only decides whether the generations count for the
+round.
+
+A team's territory (its score) is the number of squares with its value.
+*/
+
+// The phases of a round.
+const (
+	PHASE_LOBBY    = "Lobby"
+	PHASE_RUNNING  = "Running"
+	PHASE_FINISHED = "Finished"
+)
+
+// The reasons that a round can end with.
+const (
+	WIN_TERRITORY   = "Territory"
+	WIN_ELIMINATION = "Elimination"
+	WIN_TIME_LIMIT  = "TimeLimit"
+)
+
+// VictoryConditions decide when a round is over.  The zero value of each
+// condition turns it off.
+type VictoryConditions struct {
+
+	// Territory is the fraction of the board (between 0 and 1) that a team
+	// has to own in order to win.
+	Territory float64
+
+	// Elimination ends the round as soon as a team has no territory left.
+	Elimination bool
+
+	// TimeLimit is the number of generations in a round.  When time is up,
+	// the team with more territory wins.
+	TimeLimit int
+}
+
+// Score is the territory of each team.
+type Score struct {
+	Team1 int
+	Team2 int
+}
+
+// RoundResult is how a round ended.  Winner is the winning team, or 0 for
+// a draw.
+type RoundResult struct {
+	Winner      uint8
+	Reason      string
+	Score       Score
+	Generations int
+}
+
+// RoundState is everything about the current round.  Start is the tick at
+// which the round started running, and Result is only set once the round
+// has finished.
+type RoundState struct {
+	Phase  string
+	Start  int
+	Score  Score
+	Result *RoundResult
+}
+
+// Territory counts the squares that belong to each team.
+func (g *GameInstance) Territory() Score {
+	return Score{
+		Team1: g.life.a.Count(TEAM_1),
+		Team2: g.life.a.Count(TEAM_2),
+	}
+}
+
+// SetVictoryConditions changes the victory conditions, which are checked
+// from the next generation on.
+func (g *GameInstance) SetVictoryConditions(v VictoryConditions) {
+	g.victory = v
+}
+
+// VictoryConditions returns the conditions that end a round.
+func (g *GameInstance) VictoryConditions() VictoryConditions {
+	return g.victory
+}
+
+// Round returns the state of the current round.
+func (g *GameInstance) Round() RoundState {
+	return RoundState{
+		Phase:  g.phase,
+		Start:  g.roundStart,
+		Score:  g.Territory(),
+		Result: g.result,
+	}
+}
+
+// LoadRound restores the state of a round, as returned by Round.  An empty
+// phase is the lobby.
+func (g *GameInstance) LoadRound(r RoundState) {
+	g.phase = r.Phase
+	if g.phase == "" {
+		g.phase = PHASE_LOBBY
+	}
+	g.roundStart = r.Start
+	g.result = r.Result
+	g.finishedNow = false
+}
+
+// StartRound moves the round from the lobby into the running phase.  It
+// returns false if the round isn't in the lobby.
+func (g *GameInstance) StartRound() bool {
+	if g.phase != PHASE_LOBBY {
+		return false
+	}
+	g.phase = PHASE_RUNNING
+	g.roundStart = g.tick
+	g.result = nil
+	return true
+}
+
+// ResetRound goes back to the lobby, from any phase.  Both teams get their
+// starting resources back.
+func (g *GameInstance) ResetRound() {
+	g.phase = PHASE_LOBBY
+	g.roundStart = g.tick
+	g.result = nil
+	g.finishedNow = false
+	g.resetBudgets()
+}
+
+// TakeGameOver returns the result of the round, if the round has finished
+// since the last call.  Otherwise, it returns nil.
+func (g *GameInstance) TakeGameOver() *RoundResult {
+	if !g.finishedNow {
+		return nil
+	}
+	g.finishedNow = false
+	return g.result
+}
+
+// checkVictory ends the round if one of the victory conditions has been
+// met.  It is called after every generation of a running round, with the
+// territory of each team.
+func (g *GameInstance) checkVictory(s Score) {
+	if g.phase != PHASE_RUNNING {
+		return
+	}
+	v := g.victory
+
+	switch {
+	case v.Elimination && (s.Team1 == 0 || s.Team2 == 0):
+		g.finishRound(s, WIN_ELIMINATION)
+
+	case v.Territory > 0 && g.hasTerritory(s, v.Territory):
+		g.finishRound(s, WIN_TERRITORY)
+
+	case v.TimeLimit > 0 && g.tick-g.roundStart >= v.TimeLimit:
+		g.finishRound(s, WIN_TIME_LIMIT)
+	}
+}
+
+// hasTerritory reports whether either team owns the given fraction of the
+// board.
+func (g *GameInstance) hasTerritory(s Score, fraction float64) bool {
+	need := int(math.Ceil(fraction * float64(g.w*g.h)))
+	if need < 1 {
+		need = 1
+	}
+	return s.Team1 >= need || s.Team2 >= need
+}
+
+// finishRound ends the round.  The team with more territory wins.
+func (g *GameInstance) finishRound(s Score, reason string) {
+	var winner uint8
+	switch {
+	case s.Team1 > s.Team2:
+		winner = TEAM_1
+	case s.Team2 > s.Team1:
+		winner = TEAM_2
+	}
+	g.phase = PHASE_FINISHED
+	g.result = &RoundResult{
+		Winner:      winner,
+		Reason:      reason,
+		Score:       s,
+		Generations: g.tick - g.roundStart,
+	}
+	g.finishedNow = true
+}
@@ -0,0 +1,134 @@
+package gameofwar
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"sort"
+
+	"github.com/fractalbach/fractalnet/cellular/engine"
+)
+
+// ===========================================================================
+//      Grid Updates
+// ___________________________________________________________________________
+
+/*
+A GridUpdate can be encoded in 2 ways: as a json message (GridState or
+GridDelta), or as a binary websocket message.
+
+The binary message starts with a small header, in big-endian byte order:
+
+        byte  0       version, currently BINARY_VERSION
+        byte  1       kind: BINARY_STATE or BINARY_DELTA
+        byte  2       grid: BINARY_SQUARE or BINARY_HEX
+        byte  3       topology: BINARY_BOUNDED, BINARY_TORUS or BINARY_MIRROR
+        bytes 4-7     width  (uint32)
+        bytes 8-11    height (uint32)
+        bytes 12-19   tick   (uint64)
+
+The rest of the message is the same as the decoded base64 in the json
+messages: raw cell bytes for a state, or (uvarint, byte) pairs for a delta.
+*/
+
+const (
+	BINARY_VERSION     = 1
+	BINARY_STATE       = 1
+	BINARY_DELTA       = 2
+	BINARY_HEADER_SIZE = 20
+
+	BINARY_SQUARE = 0
+	BINARY_HEX    = 1
+
+	BINARY_BOUNDED = 0
+	BINARY_TORUS   = 1
+	BINARY_MIRROR  = 2
+)
+
+// GridUpdate is either the full state of the field, or the cells that have
+// changed, before it has been encoded into a message.
+type GridUpdate struct {
+
+	// Full is true when Cells contains every cell, row by row.
+	// Otherwise, Cells contains the (index gap, value) pairs of a delta.
+	Full  bool
+	Tick  int
+	W, H  int
+	Cells []byte
+
+	// Grid and Topology are the shape of the cells, and what is past the
+	// edges of the field.
+	Grid, Topology string
+}
+
+// stateUpdate returns the full state of the field.
+func stateUpdate(f *Field, tick int) *GridUpdate {
+	return &GridUpdate{
+		Full:     true,
+		Tick:     tick,
+		W:        f.Width(),
+		H:        f.Height(),
+		Cells:    f.Cells(),
+		Grid:     f.Grid(),
+		Topology: f.Topology(),
+	}
+}
+
+// changesUpdate returns only the cells at the given indexes.  They are
+// sorted, and written as pairs of (uvarint: index gap, byte: new value).
+func changesUpdate(f *Field, changes []int, tick int) *GridUpdate {
+	w, h := f.Width(), f.Height()
+	cells := f.Bytes()
+	sort.Ints(changes)
+	arr := make([]byte, 0, 2*len(changes))
+	gap := make([]byte, binary.MaxVarintLen64)
+	prev := 0
+	for _, i := range changes {
+		n := binary.PutUvarint(gap, uint64(i-prev))
+		arr = append(arr, gap[:n]...)
+		arr = append(arr, cells[i])
+		prev = i
+	}
+	return &GridUpdate{Tick: tick, W: w, H: h, Cells: arr,
+		Grid: f.Grid(), Topology: f.Topology()}
+}
+
+// JSON encodes the update as a GridState or GridDelta message.
+func (u *GridUpdate) JSON() []byte {
+	b64 := base64.StdEncoding.EncodeToString(u.Cells)
+	var v interface{} = GridDelta{b64, u.Tick}
+	if u.Full {
+		v = GridState{b64, u.Tick, u.W, u.H, u.Grid, u.Topology}
+	}
+	msg, err := json.Marshal(v)
+	if err != nil {
+		log.Println(err)
+		return []byte{}
+	}
+	return msg
+}
+
+// Binary encodes the update as a binary message, with the header described
+// at the top of this file.
+func (u *GridUpdate) Binary() []byte {
+	msg := make([]byte, BINARY_HEADER_SIZE, BINARY_HEADER_SIZE+len(u.Cells))
+	msg[0] = BINARY_VERSION
+	msg[1] = BINARY_DELTA
+	if u.Full {
+		msg[1] = BINARY_STATE
+	}
+	if u.Grid == engine.GRID_HEX {
+		msg[2] = BINARY_HEX
+	}
+	switch u.Topology {
+	case engine.TOPOLOGY_TORUS:
+		msg[3] = BINARY_TORUS
+	case engine.TOPOLOGY_MIRROR:
+		msg[3] = BINARY_MIRROR
+	}
+	binary.BigEndian.PutUint32(msg[4:8], uint32(u.W))
+	binary.BigEndian.PutUint32(msg[8:12], uint32(u.H))
+	binary.BigEndian.PutUint64(msg[12:20], uint64(u.Tick))
+	return append(msg, u.Cells...)
+}
@@ -0,0 +1,118 @@
+package gameofwar
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math/rand"
+	"testing"
+)
+
+func TestBinaryHeader(t *testing.T) {
+	tests := []struct {
+		update GridUpdate
+		want   []byte
+	}{
+		{
+			GridUpdate{Full: true, Tick: 5, W: 3, H: 2, Cells: []byte{1, 2}},
+			[]byte{
+				BINARY_VERSION, BINARY_STATE, 0, 0,
+				0, 0, 0, 3,
+				0, 0, 0, 2,
+				0, 0, 0, 0, 0, 0, 0, 5,
+				1, 2,
+			},
+		},
+		{
+			GridUpdate{Tick: 1 << 40, W: 1024, H: 70000},
+			[]byte{
+				BINARY_VERSION, BINARY_DELTA, 0, 0,
+				0, 0, 4, 0,
+				0, 1, 0x11, 0x70,
+				0, 0, 1, 0, 0, 0, 0, 0,
+			},
+		},
+	}
+	for _, test := range tests {
+		if got := test.update.Binary(); !bytes.Equal(got, test.want) {
+			t.Errorf("%+v encoded as\n%v, want\n%v",
+				test.update, got, test.want)
+		}
+	}
+}
+
+// applyDelta decodes the (uvarint gap, value) pairs of a delta the same way
+// that a client does, and writes them into the cells.
+func applyDelta(t *testing.T, cells, delta []byte) {
+	i := 0
+	for len(delta) > 0 {
+		gap, n := binary.Uvarint(delta)
+		if n <= 0 || n >= len(delta) {
+			t.Fatalf("the delta is cut short: %v", delta)
+		}
+		i += int(gap)
+		cells[i] = delta[n]
+		delta = delta[n+1:]
+	}
+}
+
+func TestDeltasRebuildTheState(t *testing.T) {
+	const w, h = 40, 20
+	before := NewField(w, h)
+	after := NewField(w, h)
+	changes := []int{}
+
+	// Spread the changes out so that some gaps need more than one byte.
+	for _, i := range []int{799, 0, 3, 4, 200, 327, 328} {
+		after.Set(i%w, i/w, uint8(i%7+1))
+		changes = append(changes, i)
+	}
+
+	state := stateUpdate(before, 0)
+	delta := changesUpdate(after, changes, 1)
+	applyDelta(t, state.Cells, delta.Cells)
+	if want := stateUpdate(after, 1).Cells; !bytes.Equal(state.Cells, want) {
+		t.Fatalf("applying the delta gives\n%v, want\n%v", state.Cells, want)
+	}
+
+	// The binary and json messages carry the same cells.
+	for _, u := range []*GridUpdate{state, delta} {
+		bin := u.Binary()
+		var msg struct {
+			GridState string
+			GridDelta string
+		}
+		if err := json.Unmarshal(u.JSON(), &msg); err != nil {
+			t.Fatal(err)
+		}
+		b64 := base64.StdEncoding.EncodeToString(bin[BINARY_HEADER_SIZE:])
+		if b64 != msg.GridState+msg.GridDelta {
+			t.Errorf("the binary cells of %+v don't match the json", u)
+		}
+	}
+}
+
+func TestPausedGameDoesntBringKeyframesCloser(t *testing.T) {
+	g := NewGameInstance(32, 32, rand.New(rand.NewSource(1)))
+	if !g.LifeChanges().Full {
+		t.Fatalf("the first update isn't the full state")
+	}
+
+	// The board is empty, so only the keyframes are full states.
+	g.Pause()
+	for i := 0; i < 3*g.keyframeEvery; i++ {
+		g.LifeUpdate()
+		if g.LifeChanges().Full {
+			t.Fatalf("update %d of a paused game is a keyframe", i)
+		}
+	}
+	g.Resume()
+	for i := 1; i <= g.keyframeEvery; i++ {
+		g.LifeUpdate()
+		if full := g.LifeChanges().Full; full != (i == g.keyframeEvery) {
+			t.Errorf("update %d after resuming: got a keyframe: %v, want %v",
+				i, full, i == g.keyframeEvery)
+		}
+	}
+}
@@ -26,57 +26,164 @@ package gameofwar
 
 import (
 	"bytes"
-	"encoding/base64"
-	"encoding/json"
-	//"fmt"
-	"log"
+	"fmt"
 	"math/rand"
-	"time"
+
+	"github.com/fractalbach/fractalnet/cellular/engine"
+	"github.com/fractalbach/fractalnet/cellular/pattern"
 )
 
 // ===========================================================================
 //      Modifiable Game Instance Settings
 // ___________________________________________________________________________
 
+// The game speed is the number of generations that pass on each tick.
 const (
 	MIN_GAME_SPEED = 1
-	MAX_GAME_SPEED = 2
+	MAX_GAME_SPEED = 8
 	maxEnumeration = 20
 )
 
+// The two teams that play the Game of War.  The team number is also the
+// value of the grid squares that belong to that team.
+const (
+	TEAM_1 uint8 = 1
+	TEAM_2 uint8 = 2
+)
+
+// DEFAULT_RULE is the name of the rule that a new game is played with.
+const DEFAULT_RULE = "war"
+
+// IsTeam reports whether the value belongs to one of the two teams, and is
+// therefore a value that a player is allowed to place onto the grid.
+func IsTeam(v uint8) bool {
+	return v == TEAM_1 || v == TEAM_2
+}
+
 // GameInstance contains all the information that would be found in the game:
 // including the map, game state, players, and settings.
 type GameInstance struct {
 	life              *Life
-	gamespeed         time.Duration
+	gamespeed         int
 	w, h              int
 	firstBombIndex    uint8
 	firstFalloutIndex uint8
 	//observer chan string
-}
 
-// NewGameInstance initializes a fresh game, only asking for a map size.
-// All of the other settings start at default.
-func NewGameInstance(w, h int) *GameInstance {
+	// rule decides how the cells change on every generation, and ruleName
+	// is the name that it was registered with.
+	rule     engine.Rule
+	ruleName string
+
+	// tick counts the generations that have passed.
+	tick int
+
+	// rng is where every random board comes from, so that a game started
+	// with the same seed makes the same boards.
+	rng *rand.Rand
+
+	// paused stops LifeUpdate from doing anything.  The game can still be
+	// moved forward with Step.
+	paused bool
+
+	// The current round: its phase, the tick that it started running at,
+	// and its result once it has finished.  finishedNow is set when the
+	// round finishes, until TakeGameOver is called.  See rounds.go.
+	phase       string
+	roundStart  int
+	result      *RoundResult
+	finishedNow bool
+	victory     VictoryConditions
+
+	// The resources and bomb cooldowns of each team.  See economy.go.
+	economy Economy
+	budgets Budgets
+
+	// keyframeEvery is the number of update messages between full states.
+	// sinceKeyframe counts the update messages since the last full state,
+	// leaving out the ones that had nothing new.  changesTick is the tick
+	// of the last update message.
+	keyframeEvery, sinceKeyframe, changesTick int
+
+	// stopAt is the tick that the game can't move past, or -1.
+	stopAt int
+}
+
+// NewGameInstance initializes a fresh game, only asking for a map size, and
+// the random number generator that makes the boards.  The generator is the
+// only source of randomness in the game, so it can't be nil: a game can
+// only be played back if it is seeded by the caller.  All of the other
+// settings start at default.
+func NewGameInstance(w, h int, rng *rand.Rand) *GameInstance {
+	if rng == nil {
+		panic("NewGameInstance: the random number generator is nil")
+	}
 	return &GameInstance{
 		w:                 w,
 		h:                 h,
-		life:              NewLife(w, h),
-		gamespeed:         1 * time.Second,
+		rng:               rng,
+		life:              NewLife(w, h, rng),
+		gamespeed:         MIN_GAME_SPEED,
 		firstBombIndex:    10,
 		firstFalloutIndex: 100,
+		keyframeEvery:     20,
+		phase:             PHASE_LOBBY,
+		rule:              warRule{},
+		ruleName:          DEFAULT_RULE,
+		stopAt:            -1,
 	}
 }
 
+// SetRule changes the rule that the cells follow, from the next generation
+// on.  The name is one of the rules registered in the engine package.  The
+// field takes the shape of grid that the rule is for.
+func (g *GameInstance) SetRule(name string) error {
+	rule, err := engine.Lookup(name)
+	if err != nil {
+		return err
+	}
+	g.rule = rule
+	g.ruleName = name
+	g.life.setGrid(engine.GridOf(rule))
+	return nil
+}
+
+// Rule returns the name of the rule that the cells follow.
+func (g *GameInstance) Rule() string {
+	return g.ruleName
+}
+
+// SetTopology changes what the cells see past the edges of the field:
+// nothing (bounded), the other side (torus), or themselves (mirror).
+func (g *GameInstance) SetTopology(t string) error {
+	return g.life.SetTopology(t)
+}
+
+// Topology returns the topology of the field.
+func (g *GameInstance) Topology() string {
+	return g.life.a.Topology()
+}
+
+// Grid returns the shape of the cells: square or hex.
+func (g *GameInstance) Grid() string {
+	return g.life.a.Grid()
+}
+
 // ===========================================================================
 //      Player Interaction
 // ___________________________________________________________________________
 
-// DropBomb takes a player number (1 or 2), and a position on the grid.
-// If that action is allowed, then it will do that action
-func (g *GameInstance) DropBomb(x, y int) bool {
+// DropBomb takes a team number (1 or 2), and a position on the grid.
+// If the team can afford it, and its bombs have cooled down, then the bomb
+// is dropped.  Otherwise, the reason why not is returned.
+//
+// Any other team number is the server itself, which drops bombs for free.
+func (g *GameInstance) DropBomb(team uint8, x, y int) error {
+	if err := g.payForBomb(team); err != nil {
+		return err
+	}
 	g.life.doLaBomba(x, y)
-	return true
+	return nil
 	/*
 		// Error Check: Player ID should only be 1 or 2.
 		if (p != 1) && (p != 2) {
@@ -151,6 +258,10 @@ func (l *Life) doLaBombaFailz(x, y int) {
 }
 
 func (l *Life) doLaBomba(x, y int) {
+	if l.a.Grid() == engine.GRID_HEX {
+		l.doLaBombaHex(x, y)
+		return
+	}
 
 	// The 8 Neighbors
 	l.AlterAt(x, y, 5)
@@ -193,97 +304,13 @@ func (l *Life) doLaBomba(x, y int) {
 //      Cellular Automata Grid and Stuff
 // ___________________________________________________________________________
 
-// Field represents a two-dimensional field of cells.
-type Field struct {
-	s    [][]uint8
-	w, h int
-}
+// Field represents a two-dimensional field of cells.  It is the same Field
+// that every rule in the engine package steps through.
+type Field = engine.Field
 
-// Neighborhood stores 2 useful maps:
-// 1. The cell values based on location,
-// 2. The total number of cells found nearby, based on a specific cell value.
-type Neighborhood struct {
-	direct map[uint8]uint8
-	totals map[uint8]uint8
-}
-
-// North returns the value at coordinate (+0, -1) relative to center.
-func (n *Neighborhood) North() uint8 {
-	return n.direct[0]
-}
-
-// South returns the value at coordinate (+0, +1) relative to center.
-func (n *Neighborhood) South() uint8 {
-	return n.direct[1]
-}
-
-// East returns the value at coordinate (+1, +0) relative to center.
-func (n *Neighborhood) East() uint8 {
-	return n.direct[2]
-}
-
-// West returns the value at coordinate (-1, +0) relative to center.
-func (n *Neighborhood) West() uint8 {
-	return n.direct[3]
-}
-
-// NorthEast returns the value at coordinate (+1, -1) relative to center.
-func (n *Neighborhood) NorthEast() uint8 {
-	return n.direct[4]
-}
-
-// NorthWest returns the value at coordinate (-1, -1) relative to center.
-func (n *Neighborhood) NorthWest() uint8 {
-	return n.direct[5]
-}
-
-// SouthEast returns the value at coordinate (+1, +1) relative to center.
-func (n *Neighborhood) SouthEast() uint8 {
-	return n.direct[6]
-}
-
-// SouthWest returns the value at coordinate (+1, -1) relative to center.
-func (n *Neighborhood) SouthWest() uint8 {
-	return n.direct[7]
-}
-
-// Count returns the total number of cells in the neighborhood that contain
-// the specified value.
-func (n *Neighborhood) Count(cellValue uint8) uint8 {
-	return n.totals[cellValue]
-}
-
-// NewMooreNeighborhood returns a neighborhood of cells that include the 4
-// cardinal directions and the 4 diagonals, for a total of 8 nearby cells.
-func NewMooreNeighborhood(f *Field, x, y int) *Neighborhood {
-	n := Neighborhood{
-		direct: map[uint8]uint8{
-			0: f.WhatIs(x, y-1),   // North
-			1: f.WhatIs(x, y+1),   // South
-			2: f.WhatIs(x+1, y),   //East
-			3: f.WhatIs(x-1, y),   // West
-			4: f.WhatIs(x+1, y-1), // North-East
-			5: f.WhatIs(x-1, y-1), // North-West
-			6: f.WhatIs(x+1, y+1), // South-East
-			7: f.WhatIs(x-1, y+1), // South-West
-		},
-		totals: map[uint8]uint8{
-			0: 0, // Empty Neutral
-			1: 0, // player 1
-			2: 0, // player 2
-			3: 0, // A
-			4: 0, // B
-			5: 0, // C
-			6: 0, // Static? (may be not used)
-			7: 0,
-		},
-	}
-	for _, cellValue := range n.direct {
-		if _, ok := n.totals[cellValue]; ok {
-			n.totals[cellValue]++
-		}
-	}
-	return &n
+// NewField returns an empty field of the specified width and height.
+func NewField(w, h int) *Field {
+	return engine.NewField(w, h)
 }
 
 // WhoEatsMe returns the color that consumes the specified color, if nearby.
@@ -310,76 +337,104 @@ func WhoEatsMe(myColor uint8) uint8 {
 	// uint8(rand.Intn(5))
 }
 */
-// Abundance the color(s), which corresponds to a value [1-3],
-// and the number of counted neighbors of that color [0-8].
-// Since there could be a tie for the highest count,
-// multiple colors are returned in an array.
-func Abundance(neighborhood map[uint8]uint8) ([]uint8, uint8) {
-	var greatColor []uint8
-	var greatValue uint8
-	for k, v := range neighborhood {
-		if v == greatValue {
-			greatColor = append(greatColor, k)
-			continue
-		}
-		if v > greatValue {
-			greatColor = []uint8{k}
-			greatValue = v
-		}
-	}
-	return greatColor, greatValue
-}
-
-// NewField returns an empty field of the specified width and height.
-func NewField(w, h int) *Field {
-	s := make([][]uint8, h)
-	for i := range s {
-		s[i] = make([]uint8, w)
-	}
-	return &Field{s: s, w: w, h: h}
-}
-
-// Set sets the state of the specified cell to the given value.
-func (f *Field) Set(x, y int, b uint8) {
-	f.s[y][x] = b
-}
-
-// WhatsIs reports the number that is at the specified cell.
-func (f *Field) WhatIs(x, y int) uint8 {
-	//x += f.w
-	//x %= f.w
-	//y += f.h
-	//y %= f.h
-	if (x < 0) || (y < 0) || (x >= f.w) || (y >= f.h) {
-		return 0
-	}
-	return f.s[y][x]
-}
-
 // Life stores the state of a round of Conway's Game of Life.
+//
+// Life also remembers which cells have changed since the last time that
+// the changes were taken, so that only those cells need to be sent.
 type Life struct {
 	a, b *Field
 	w, h int
+
+	// topology decides what is past the edges, and grid is the shape of the
+	// cells, for both fields and for any field that replaces them.
+	topology string
+	grid     string
+
+	// changed[y*w+x] is true if the cell at (x,y) is listed in changes.
+	changed []bool
+	changes []int
+
+	// everything is true when the whole field has been replaced.
+	everything bool
 }
 
-// NewLife returns a new Life game state with a random initial state.
-func NewLife(w, h int) *Life {
+// NewLife returns a new Life game state with a random initial state, which
+// comes from rng.
+func NewLife(w, h int, rng *rand.Rand) *Life {
 	a := NewField(w, h)
 
 	for i := 0; i < w; i++ {
 		for j := 0; j < h; j++ {
-			a.Set(i, j, uint8(rand.Intn(2)+1))
+			a.Set(i, j, uint8(rng.Intn(2)+1))
 		}
 	}
 	/*
 		for i := 0; i < (w * h / 4); i++ {
-			a.Set(rand.Intn(w), rand.Intn(h), uint8(rand.Intn(2)+1))
+			a.Set(rng.Intn(w), rng.Intn(h), uint8(rng.Intn(2)+1))
 		}
 	*/
 	return &Life{
 		a: a, b: NewField(w, h),
 		w: w, h: h,
+		changed:    make([]bool, w*h),
+		everything: true,
+	}
+}
+
+// newField returns an empty field with the same size and topology as the
+// game's fields.
+func (l *Life) newField() *Field {
+	f := NewField(l.w, l.h)
+	f.SetTopology(l.topology)
+	f.SetGrid(l.grid)
+	return f
+}
+
+// setGrid changes the shape of the cells.  If it is a new shape, then the
+// whole field is sent again, so that clients can draw it the new way.
+func (l *Life) setGrid(g string) {
+	if g == l.a.Grid() {
+		return
+	}
+	l.grid = g
+	l.a.SetGrid(g)
+	l.b.SetGrid(g)
+	l.everything = true
+}
+
+// SetTopology changes what the cells see past the edges of the field.  It
+// is one of the engine's topologies: bounded, torus or mirror.
+func (l *Life) SetTopology(t string) error {
+	if err := engine.ValidTopology(t); err != nil {
+		return err
 	}
+	l.topology = t
+	l.a.SetTopology(t)
+	l.b.SetTopology(t)
+	return nil
+}
+
+// markChanged remembers that the cell at (x,y) has changed.
+func (l *Life) markChanged(x, y int) {
+	i := y*l.w + x
+	if l.changed[i] {
+		return
+	}
+	l.changed[i] = true
+	l.changes = append(l.changes, i)
+}
+
+// takeChanges returns the indexes of the cells that have changed since the
+// last call, and whether the whole field has been replaced.  Afterwards, no
+// cells are marked as changed.
+func (l *Life) takeChanges() ([]int, bool) {
+	changes, everything := l.changes, l.everything
+	for _, i := range changes {
+		l.changed[i] = false
+	}
+	l.changes = nil
+	l.everything = false
+	return changes, everything
 }
 
 // ResetGameInstance will randomly create player squares.
@@ -388,32 +443,31 @@ func (g *GameInstance) RandomizeGameBoard(numberToMake int) {
 	if numberToMake <= 0 {
 		numberToMake = g.w * g.h / 4
 	}
-	a := NewField(g.w, g.h)
+	a := g.life.newField()
 	for i := 0; i < numberToMake; i++ {
-		a.Set(rand.Intn(g.w), rand.Intn(g.h), uint8(rand.Intn(2)+1))
+		a.Set(g.rng.Intn(g.w), g.rng.Intn(g.h), uint8(g.rng.Intn(2)+1))
 	}
 	g.life.a = a
+	g.life.everything = true
 }
 
 func (g *GameInstance) FreshGameBoard() {
 	w, h := g.w, g.h
-	a := NewField(w, h)
+	a := g.life.newField()
 	for i := 0; i < w; i++ {
 		for j := 0; j < h; j++ {
-			a.Set(i, j, uint8(rand.Intn(2)+1))
+			a.Set(i, j, uint8(g.rng.Intn(2)+1))
 		}
 	}
 	g.life.a = a
+	g.life.everything = true
 }
 
-// Step advances the game by one instant, recomputing and updating all cells.
-func (l *Life) Step() {
+// Step advances the game by one instant, recomputing and updating all cells
+// with the given rule.
+func (l *Life) Step(rule engine.Rule) {
 	// Update the state of the next field (b) from the current field (a).
-	for y := 0; y < l.h; y++ {
-		for x := 0; x < l.w; x++ {
-			l.b.Set(x, y, l.a.Next(x, y))
-		}
-	}
+	engine.StepParallel(rule, l.a, l.b, l.markChanged, 0)
 	// Swap fields a and b.
 	l.a, l.b = l.b, l.a
 }
@@ -457,45 +511,250 @@ func (l *Life) String() string {
 	return buf.String()
 }
 
+// GridState is the full state of the field, at the given tick.  The size of
+// the field is included, because it depends on the server's config.  So are
+// the shape of the cells (square or hex) and the topology of the edges, so
+// that clients know how to draw them.
 type GridState struct {
 	GridState string
+	Tick      int
+	Width     int
+	Height    int
+	Grid      string
+	Topology  string
+}
+
+// GridDelta lists the cells that have changed since the previous GridState
+// or GridDelta message.  Once decoded from base64, it is a list of pairs:
+//
+//      (uvarint: index gap, byte: new value)
+//
+// The index of a cell is y*width + x.  The index gap is the difference
+// between this index, and the index of the previous pair (or 0 for the
+// first pair).
+type GridDelta struct {
+	GridDelta string
+	Tick      int
+}
+
+// LifeStateMessage returns an encoded Json message, ready to be sent.  The
+// field of cells is converted into an array, then encoded in base64, then
+// encapsulated in a json message called "GridState".
+func (g *GameInstance) LifeStateMessage() []byte {
+	return g.LifeState().JSON()
 }
 
-// encodeFieldData converts the field of cells into an array, then encodes
-// them in base64.  Then, it is encapsulated in a json message called
-// "GridState".  The JSON is returned in the form of a byte array.
-func (f *Field) encodeFieldData() []byte {
-	arr := []byte{}
-	for _, v := range f.s {
-		arr = append(arr, v...)
+// LifeState returns the full state of the field, ready to be encoded.
+func (g *GameInstance) LifeState() *GridUpdate {
+	return stateUpdate(g.life.a, g.tick)
+}
+
+// LifeChanges returns the changes since the previous call to LifeChanges.
+//
+// Usually, that is a delta.  The full state is returned instead when the
+// whole field has been replaced, when the delta would be larger than the
+// full state, or when it is time for a keyframe.  While the game is paused,
+// the empty deltas don't bring the next keyframe any closer.
+func (g *GameInstance) LifeChanges() *GridUpdate {
+	changes, everything := g.life.takeChanges()
+	if g.tick != g.changesTick || len(changes) > 0 {
+		g.sinceKeyframe++
 	}
-	b64 := base64.StdEncoding.EncodeToString(arr)
-	msg, err := json.Marshal(GridState{b64})
-	if err != nil {
-		log.Println(err)
-		return []byte{}
+	g.changesTick = g.tick
+	if everything || g.sinceKeyframe >= g.keyframeEvery ||
+		2*len(changes) >= g.w*g.h {
+		g.sinceKeyframe = 0
+		return g.LifeState()
 	}
-	return msg
+	return changesUpdate(g.life.a, changes, g.tick)
 }
 
-// LifeStateMessage returns an encoded Json message, ready to be sent.
-func (g *GameInstance) LifeStateMessage() []byte {
-	return g.life.a.encodeFieldData()
+// Tick returns the number of generations that have passed.
+func (g *GameInstance) Tick() int {
+	return g.tick
+}
+
+// String returns the game board as a string, one line per row.
+func (g *GameInstance) String() string {
+	return g.life.String()
+}
+
+// Cells returns a copy of the field as an array of bytes, one per cell,
+// row by row.
+func (g *GameInstance) Cells() []byte {
+	return g.life.a.Cells()
+}
+
+// LoadCells replaces the field with the given cells, in the same form that
+// is returned by Cells, and sets the number of generations that have passed.
+func (g *GameInstance) LoadCells(cells []byte, tick int) error {
+	if len(cells) != g.w*g.h {
+		return fmt.Errorf("LoadCells: have %d cells, but need %d x %d",
+			len(cells), g.w, g.h)
+	}
+	a := g.life.newField()
+	copy(a.Bytes(), cells)
+	g.life.a = a
+	g.life.everything = true
+	g.tick = tick
+	return nil
 }
 
 func (g *GameInstance) ChangeAt(x, y int, val uint8) {
 	g.life.AlterAt(x, y, val)
 }
 
+// Stamp changes the field under every cell of the pattern that isn't 0,
+// with the top left corner of the pattern at (x,y).  The cells become val,
+// or keep the pattern's own values if val is 0.
+func (g *GameInstance) Stamp(p *pattern.Pattern, x, y int, val uint8) {
+	for j := 0; j < p.Height; j++ {
+		for i := 0; i < p.Width; i++ {
+			v := p.At(i, j)
+			if v == 0 {
+				continue
+			}
+			if val != 0 {
+				v = val
+			}
+			g.life.AlterAt(x+i, y+j, v)
+		}
+	}
+}
+
+// PlacePattern stamps the pattern for a team (1 or 2), like Stamp.  Teams
+// can only place patterns while the round is running, and like a bomb, the
+// team has to be able to afford it (by its living cells), and its bombs
+// have to have cooled down.  Otherwise, the reason why not is returned.
+//
+// Any other value is the server itself, which places patterns for free.
+func (g *GameInstance) PlacePattern(p *pattern.Pattern, x, y int,
+	val uint8) error {
+
+	if IsTeam(val) {
+		if g.phase != PHASE_RUNNING {
+			return ErrRoundNotRunning
+		}
+		if err := g.payForPattern(val, p.Count()); err != nil {
+			return err
+		}
+	}
+	g.Stamp(p, x, y, val)
+	return nil
+}
+
+// Region copies a rectangle of the field into a pattern, with the rule in
+// its header.  The rectangle is cut down to fit in the field.
+func (g *GameInstance) Region(x, y, w, h int) *pattern.Pattern {
+	p := pattern.FromField(g.life.a, x, y, w, h)
+	p.Rule = g.ruleName
+	return p
+}
+
+// LifeUpdate is called on every tick.  Unless the game is paused, it moves
+// the game forward by as many generations as the game speed.  The board
+// moves in every phase of the round; only the income, the cooldowns and
+// the victory conditions wait for the round to be running (see advance).
 func (g *GameInstance) LifeUpdate() {
-	g.life.Step()
+	if g.paused {
+		return
+	}
+	for i := 0; i < g.gamespeed && !g.stopped(); i++ {
+		g.advance()
+	}
+}
+
+// advance moves the game forward by a single generation.  If the round is
+// running, then the teams earn their income, and the victory conditions
+// are checked.
+func (g *GameInstance) advance() {
+	g.life.Step(g.rule)
+	g.tick++
+	if g.phase != PHASE_RUNNING {
+		return
+	}
+	s := g.Territory()
+	g.earn(s)
+	g.checkVictory(s)
 }
 
-// AlterAt changes the value at a specific position of the field.
+// ===========================================================================
+//      Playback Controls
+// ___________________________________________________________________________
+
+// Pause stops the game from moving forward on its own.  It returns false if
+// the game was already paused.
+func (g *GameInstance) Pause() bool {
+	if g.paused {
+		return false
+	}
+	g.paused = true
+	return true
+}
+
+// Resume undoes Pause.  It returns false if the game wasn't paused.
+func (g *GameInstance) Resume() bool {
+	if !g.paused {
+		return false
+	}
+	g.paused = false
+	return true
+}
+
+// Paused reports whether the game has been paused.
+func (g *GameInstance) Paused() bool {
+	return g.paused
+}
+
+// Step moves a paused game forward by n generations.  It returns false if
+// the game isn't paused.
+func (g *GameInstance) Step(n int) bool {
+	if !g.paused {
+		return false
+	}
+	for i := 0; i < n && !g.stopped(); i++ {
+		g.advance()
+	}
+	return true
+}
+
+// StopAt keeps the game from moving past the given tick, which is used to
+// replay a game up to a certain point.  A negative tick lets it go on again.
+func (g *GameInstance) StopAt(tick int) {
+	g.stopAt = tick
+}
+
+func (g *GameInstance) stopped() bool {
+	return g.stopAt >= 0 && g.tick >= g.stopAt
+}
+
+// Speed returns the number of generations that pass on each tick.
+func (g *GameInstance) Speed() int {
+	return g.gamespeed
+}
+
+// SetSpeed changes the number of generations that pass on each tick.  It
+// returns false if the speed isn't between MIN_GAME_SPEED and
+// MAX_GAME_SPEED.
+func (g *GameInstance) SetSpeed(speed int) bool {
+	if speed < MIN_GAME_SPEED || speed > MAX_GAME_SPEED {
+		return false
+	}
+	g.gamespeed = speed
+	return true
+}
+
+// AlterAt changes the value at a specific position of the field.  On a
+// torus, positions past the edge wrap around to the other side; otherwise,
+// they are ignored.
 func (l *Life) AlterAt(x, y int, val uint8) {
-	if (x < 0) || (y < 0) || (x >= l.w) || (y >= l.h) {
+	x, y, ok := l.a.Wrap(x, y)
+	if !ok {
 		return
 	}
+	if l.a.WhatIs(x, y) != val {
+		l.markChanged(x, y)
+	}
 	l.a.Set(x, y, val)
 }
 
@@ -505,38 +764,17 @@ func (l *Life) AlterAt(x, y int, val uint8) {
 // |_________________________________________________________________________|
 // |~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~|
 
-// Next returns the state of the specified cell at the next time step.
-func (f *Field) Next(x, y int) uint8 {
-	/*
-		cellsToCheck := []uint8{ // Count values in adjacent cells.
-			f.WhatIs(x, y+1),
-			f.WhatIs(x, y-1),
-
-			f.WhatIs(x-1, y-1),
-			f.WhatIs(x-1, y),
-			f.WhatIs(x-1, y+1),
-
-			f.WhatIs(x+1, y-1),
-			f.WhatIs(x+1, y+1),
-			f.WhatIs(x+1, y),
-
-			// Von Neumann group
-			f.WhatIs(x, y+2),
-			f.WhatIs(x, y-2),
-			f.WhatIs(x+2, y),
-			f.WhatIs(x-2, y),
-		}
-		// Make a "neighborhood" HashMap to hold the (Key, Value) Pairs.
-		// Count the cells values, and add them to the counters.
-		n := NewNeighborhood()
-		for _, cellValue := range cellsToCheck {
-			if _, ok := n[cellValue]; ok {
-				n[cellValue]++
-			}
-		}
-	*/
-	n := NewMooreNeighborhood(f, x, y)
-	me := f.WhatIs(x, y) // What value is at this cell?``
+// warRule is the rule of the Game of War.  Empty squares are taken by the
+// team with more points nearby, and bombs burn out through the values 3 to 7.
+type warRule struct{}
+
+func (warRule) Neighbors() []engine.Offset {
+	return engine.Moore
+}
+
+// Next returns the state of the cell at the next time step.
+func (warRule) Next(n *engine.Neighborhood) uint8 {
+	me := n.Me // What value is at this cell?
 	//enemy := WhoEatsMe(me) // What cell eats this value?
 
 	if me >= 7 {
@@ -622,6 +860,10 @@ func (f *Field) Next(x, y int) uint8 {
 	return me
 }
 
+func init() {
+	engine.Register(DEFAULT_RULE, warRule{})
+}
+
 // \_________________________________________________________________________/
 
 // Rules if you are an empty square. Contested squares are not filled.
@@ -0,0 +1,78 @@
+package gameofwar
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/fractalbach/fractalnet/cellular/engine"
+
+	// These packages register the wave and rgb rules.
+	_ "github.com/fractalbach/fractalnet/cellular"
+	_ "github.com/fractalbach/fractalnet/cellular/wave"
+)
+
+// BenchmarkLifeStep times a whole generation of the game with each rule,
+// and how much memory it takes.
+func BenchmarkLifeStep(b *testing.B) {
+	for _, name := range []string{DEFAULT_RULE, "wave", "rgb", "conway"} {
+		rule, err := engine.Lookup(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, size := range []int{256, 1024} {
+			b.Run(fmt.Sprintf("%s/%dx%d", name, size, size),
+				func(b *testing.B) {
+					l := NewLife(size, size, rand.New(rand.NewSource(1)))
+					b.ReportAllocs()
+					b.ResetTimer()
+					for n := 0; n < b.N; n++ {
+						l.Step(rule)
+					}
+				})
+		}
+	}
+}
+
+// TestBoardMovesInEveryPhase checks that the board moves on every tick, in
+// every phase of a round, and that only a running round earns income.
+func TestBoardMovesInEveryPhase(t *testing.T) {
+	tests := []struct {
+		phase string
+		earns bool
+	}{
+		{PHASE_LOBBY, false},
+		{PHASE_RUNNING, true},
+		{PHASE_FINISHED, false},
+	}
+	for _, tt := range tests {
+		g := NewGameInstance(32, 32, rand.New(rand.NewSource(1)))
+		g.SetEconomy(Economy{MaxResources: 1000, Income: 1})
+		g.RandomizeGameBoard(0)
+		switch tt.phase {
+		case PHASE_RUNNING:
+			g.StartRound()
+		case PHASE_FINISHED:
+			g.LoadRound(RoundState{Phase: PHASE_FINISHED})
+		}
+		cells := g.Cells()
+		budgets := g.Budgets()
+
+		g.LifeUpdate()
+		if g.Round().Phase != tt.phase {
+			t.Fatalf("%s: the round went to %s in a tick",
+				tt.phase, g.Round().Phase)
+		}
+		if g.Tick() != g.Speed() {
+			t.Errorf("%s: a tick moved the game to tick %d, want %d",
+				tt.phase, g.Tick(), g.Speed())
+		}
+		if string(g.Cells()) == string(cells) {
+			t.Errorf("%s: the board didn't move in a tick", tt.phase)
+		}
+		if earned := g.Budgets() != budgets; earned != tt.earns {
+			t.Errorf("%s: the budgets went from %+v to %+v",
+				tt.phase, budgets, g.Budgets())
+		}
+	}
+}
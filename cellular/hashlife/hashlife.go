@@ -0,0 +1,419 @@
+/*
+Package hashlife runs Life-like rules on a plane with no edges, with Bill
+Gosper's HashLife algorithm, so that huge or long-running patterns can be
+moved forward by millions of generations at once.
+
+The plane is a quadtree.  A node of level k is a square of 2^k x 2^k cells,
+made of 4 nodes of level k-1 (its quadrants), down to single cells at level
+0.  Nodes are never changed, and there is only ever one node for each square
+of cells, so a pattern that repeats itself (or a lot of empty space) only
+takes up a little memory:
+
+        +-------+-------+
+        |  nw   |  ne   |       a node of level k, with 4 quadrants
+        |       |       |       of level k-1
+        +-------+-------+
+        |  sw   |  se   |
+        |       |       |
+        +-------+-------+
+
+The trick is that the middle of a node, 2^(k-1) cells wide, only depends on
+the node itself for the next 2^(k-2) generations, because nothing can move
+faster than one cell per generation.  That future middle is worked out once
+for each node, by putting together the futures of smaller nodes, and then
+it is remembered.  Since the same nodes come up again and again, jumping
+forward by 2^k generations takes about as long as jumping by one.
+*/
+package hashlife
+
+import (
+	"fmt"
+
+	"github.com/fractalbach/fractalnet/cellular/engine"
+	"github.com/fractalbach/fractalnet/cellular/pattern"
+)
+
+// ===========================================================================
+//      Nodes
+// ___________________________________________________________________________
+
+// node is a square of 2^level x 2^level cells.  A node of level 0 is a
+// single cell, which is alive if pop is 1.
+type node struct {
+	nw, ne, sw, se *node
+	level          uint
+	pop            int64
+}
+
+// quad is the key of a node in the table of nodes.
+type quad struct {
+	nw, ne, sw, se *node
+}
+
+// step is the key of a node's future: the node, and the number of
+// generations that it moves forward (2^j).
+type step struct {
+	n *node
+	j uint
+}
+
+// MAX_LEVEL is the biggest node that a Universe can have.  It keeps the
+// coordinates of every cell, from -2^61 to 2^61, inside of an int64.
+const MAX_LEVEL = 62
+
+// MIN_LEVEL is the smallest that the root of a Universe can be.
+const MIN_LEVEL = 3
+
+// MAX_NODES is the number of nodes that a Universe can remember before it
+// forgets everything that isn't part of the pattern.
+const MAX_NODES = 1 << 22
+
+// ===========================================================================
+//      Universes
+// ___________________________________________________________________________
+
+// Universe is a Life pattern on a plane that goes on forever, in every
+// direction.  Cells are at int64 coordinates, and start out dead.
+type Universe struct {
+	root *node
+
+	// x and y are the coordinates of the top left corner of the root.
+	x, y int64
+
+	generation int64
+	rule       *engine.LifeLike
+
+	// nodes has every node that has been made, so that each square of cells
+	// only has one node, and futures remembers the futures of nodes.
+	nodes   map[quad]*node
+	futures map[step]*node
+
+	// dead and alive are the two cells, and empty[k] is the empty node of
+	// level k.
+	dead, alive *node
+	empty       []*node
+}
+
+// New returns an empty universe, with Conway's rule, and the cell (0,0)
+// near the middle of it.
+func New() *Universe {
+	u := &Universe{
+		rule:    engine.MustParseRule("B3/S23"),
+		nodes:   map[quad]*node{},
+		futures: map[step]*node{},
+		dead:    &node{},
+		alive:   &node{pop: 1},
+	}
+	u.empty = []*node{u.dead}
+	u.root = u.emptyNode(MIN_LEVEL)
+	half := int64(1) << (MIN_LEVEL - 1)
+	u.x, u.y = -half, -half
+	return u
+}
+
+// Rule returns the rule of the universe.
+func (u *Universe) Rule() *engine.LifeLike {
+	return u.rule
+}
+
+// SetRule changes the rule of the universe.  It must be a Life-like rule
+// with two states, on a square grid, where empty space stays empty (so it
+// can't have B0).  The futures of the old rule are forgotten.
+func (u *Universe) SetRule(r *engine.LifeLike) error {
+	if r.States > 2 {
+		return fmt.Errorf("%s has %d states, but HashLife only has 2",
+			r, r.States)
+	}
+	if r.Hex {
+		return fmt.Errorf("%s is for a hex grid, but HashLife is square", r)
+	}
+	if r.Birth[0] {
+		return fmt.Errorf("%s has B0, so empty space wouldn't stay empty", r)
+	}
+	u.rule = r
+	u.futures = map[step]*node{}
+	return nil
+}
+
+// Generation returns the number of generations that have passed.
+func (u *Universe) Generation() int64 {
+	return u.generation
+}
+
+// Population returns the number of living cells.
+func (u *Universe) Population() int64 {
+	return u.root.pop
+}
+
+// Nodes returns the number of different squares of cells that the universe
+// remembers.  It is a rough measure of how much memory it is using.
+func (u *Universe) Nodes() int {
+	return len(u.nodes)
+}
+
+// join returns the node made of the 4 quadrants.
+func (u *Universe) join(nw, ne, sw, se *node) *node {
+	k := quad{nw, ne, sw, se}
+	if n, ok := u.nodes[k]; ok {
+		return n
+	}
+	n := &node{
+		nw: nw, ne: ne, sw: sw, se: se,
+		level: nw.level + 1,
+		pop:   nw.pop + ne.pop + sw.pop + se.pop,
+	}
+	u.nodes[k] = n
+	return n
+}
+
+// emptyNode returns the node of the level with no living cells.
+func (u *Universe) emptyNode(level uint) *node {
+	for uint(len(u.empty)) <= level {
+		e := u.empty[len(u.empty)-1]
+		u.empty = append(u.empty, u.join(e, e, e, e))
+	}
+	return u.empty[level]
+}
+
+// size returns the width of the root.
+func (u *Universe) size() int64 {
+	return int64(1) << u.root.level
+}
+
+// contains reports whether (x,y) is inside of the root.
+func (u *Universe) contains(x, y int64) bool {
+	return x >= u.x && y >= u.y && x-u.x < u.size() && y-u.y < u.size()
+}
+
+// expand doubles the size of the root, keeping it in the middle.
+func (u *Universe) expand() {
+	r := u.root
+	if r.level >= MAX_LEVEL {
+		panic("hashlife: the universe can't get any bigger")
+	}
+	e := u.emptyNode(r.level - 1)
+	u.root = u.join(
+		u.join(e, e, e, r.nw), u.join(e, e, r.ne, e),
+		u.join(e, r.sw, e, e), u.join(r.se, e, e, e))
+	half := int64(1) << (r.level - 1)
+	u.x, u.y = u.x-half, u.y-half
+}
+
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+//      Cells
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+// Alive reports whether the cell at (x,y) is alive.
+func (u *Universe) Alive(x, y int64) bool {
+	if !u.contains(x, y) {
+		return false
+	}
+	n := u.root
+	x, y = x-u.x, y-u.y
+	for n.level > 0 && n.pop > 0 {
+		half := int64(1) << (n.level - 1)
+		switch {
+		case x < half && y < half:
+			n = n.nw
+		case y < half:
+			n, x = n.ne, x-half
+		case x < half:
+			n, y = n.sw, y-half
+		default:
+			n, x, y = n.se, x-half, y-half
+		}
+	}
+	return n.pop > 0 && n.level == 0
+}
+
+// Set makes the cell at (x,y) alive or dead.  The universe grows to fit
+// it, as long as it is within 2^61 cells of the middle.
+func (u *Universe) Set(x, y int64, alive bool) {
+	for !u.contains(x, y) {
+		u.expand()
+	}
+	u.root = u.set(u.root, x-u.x, y-u.y, alive)
+}
+
+// set returns the node with the cell at (x,y) of the node changed.
+func (u *Universe) set(n *node, x, y int64, alive bool) *node {
+	if n.level == 0 {
+		if alive {
+			return u.alive
+		}
+		return u.dead
+	}
+	half := int64(1) << (n.level - 1)
+	switch {
+	case x < half && y < half:
+		return u.join(u.set(n.nw, x, y, alive), n.ne, n.sw, n.se)
+	case y < half:
+		return u.join(n.nw, u.set(n.ne, x-half, y, alive), n.sw, n.se)
+	case x < half:
+		return u.join(n.nw, n.ne, u.set(n.sw, x, y-half, alive), n.se)
+	}
+	return u.join(n.nw, n.ne, n.sw, u.set(n.se, x-half, y-half, alive))
+}
+
+// Rect is a rectangle of cells, with its top left corner at (X,Y).
+type Rect struct {
+	X, Y int64
+	W, H int64
+}
+
+// BoundingBox returns the smallest rectangle that has every living cell.
+// It returns false if there aren't any.
+func (u *Universe) BoundingBox() (Rect, bool) {
+	if u.root.pop == 0 {
+		return Rect{}, false
+	}
+	// Each edge is found by looking for the living cell that is furthest
+	// that way, and skipping every empty node on the way.
+	r, size := u.root, u.size()
+	x0 := u.x + edge(r, west)
+	y0 := u.y + edge(r, north)
+	x1 := u.x + size - 1 - edge(r, east)
+	y1 := u.y + size - 1 - edge(r, south)
+	return Rect{X: x0, Y: y0, W: x1 - x0 + 1, H: y1 - y0 + 1}, true
+}
+
+// halves splits a node into the two quadrants along one of its edges (near)
+// and the other two (far).
+type halves func(n *node) (near1, near2, far1, far2 *node)
+
+func west(n *node) (*node, *node, *node, *node)  { return n.nw, n.sw, n.ne, n.se }
+func north(n *node) (*node, *node, *node, *node) { return n.nw, n.ne, n.sw, n.se }
+func east(n *node) (*node, *node, *node, *node)  { return n.ne, n.se, n.nw, n.sw }
+func south(n *node) (*node, *node, *node, *node) { return n.sw, n.se, n.nw, n.ne }
+
+// edge returns how far in from one edge of the node the first living cell
+// is.  The node must not be empty.
+func edge(n *node, split halves) int64 {
+	if n.level == 0 {
+		return 0
+	}
+	a, b, c, d := split(n)
+	var offset int64
+	if a.pop+b.pop == 0 {
+		a, b, offset = c, d, int64(1)<<(n.level-1)
+	}
+	switch {
+	case a.pop == 0:
+		return offset + edge(b, split)
+	case b.pop == 0:
+		return offset + edge(a, split)
+	}
+	ea, eb := edge(a, split), edge(b, split)
+	if eb < ea {
+		ea = eb
+	}
+	return offset + ea
+}
+
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+//      Buffers
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+// FromBuffer returns a universe with the cells of the buffer that aren't 0
+// alive, with the top left corner of the buffer at (0,0).
+func FromBuffer(cells engine.Buffer) *Universe {
+	u := New()
+	level := uint(MIN_LEVEL)
+	for int64(1)<<level < int64(cells.Width()) ||
+		int64(1)<<level < int64(cells.Height()) {
+		level++
+	}
+	u.root = u.build(cells, level, 0, 0)
+	u.x, u.y = 0, 0
+	return u
+}
+
+// build returns the node of the level with its top left corner at (x,y) of
+// the buffer.  Cells past the edge of the buffer are dead.
+func (u *Universe) build(cells engine.Buffer, level uint, x, y int) *node {
+	if x >= cells.Width() || y >= cells.Height() {
+		return u.emptyNode(level)
+	}
+	if level == 0 {
+		if cells.At(x, y) != 0 {
+			return u.alive
+		}
+		return u.dead
+	}
+	half := 1 << (level - 1)
+	return u.join(
+		u.build(cells, level-1, x, y), u.build(cells, level-1, x+half, y),
+		u.build(cells, level-1, x, y+half),
+		u.build(cells, level-1, x+half, y+half))
+}
+
+// Buffer returns the w*h cells with their top left corner at (x,y), one
+// byte per cell, where living cells are 1.
+func (u *Universe) Buffer(x, y int64, w, h int) engine.Buffer {
+	cells := engine.NewBuffer(w, h)
+	u.fill(cells, u.root, u.x-x, u.y-y)
+	return cells
+}
+
+// fill copies the living cells of the node, with its top left corner at
+// (x,y) of the buffer, into the buffer.
+func (u *Universe) fill(cells engine.Buffer, n *node, x, y int64) {
+	size := int64(1) << n.level
+	if n.pop == 0 || x >= int64(cells.Width()) || y >= int64(cells.Height()) ||
+		x+size <= 0 || y+size <= 0 {
+		return
+	}
+	if n.level == 0 {
+		cells.Set(int(x), int(y), 1)
+		return
+	}
+	half := size / 2
+	u.fill(cells, n.nw, x, y)
+	u.fill(cells, n.ne, x+half, y)
+	u.fill(cells, n.sw, x, y+half)
+	u.fill(cells, n.se, x+half, y+half)
+}
+
+// FromPattern returns a universe with the cells of the pattern that aren't 0
+// alive, with its top left corner at (0,0).  If the pattern has a rule in
+// its header, then the universe uses it.
+func FromPattern(p *pattern.Pattern) (*Universe, error) {
+	cells := engine.NewBuffer(p.Width, p.Height)
+	for y := 0; y < p.Height; y++ {
+		for x := 0; x < p.Width; x++ {
+			cells.Set(x, y, p.At(x, y))
+		}
+	}
+	u := FromBuffer(cells)
+	if p.Rule != "" {
+		rule, err := engine.ParseRule(p.Rule)
+		if err != nil {
+			return nil, err
+		}
+		if err := u.SetRule(rule); err != nil {
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+// Pattern returns the living cells as a pattern, cut down to their bounding
+// box, with the rule of the universe.  It returns an error if they don't
+// fit in a pattern.
+func (u *Universe) Pattern() (*pattern.Pattern, error) {
+	box, _ := u.BoundingBox()
+	if box.W > pattern.MAX_PATTERN_SIZE || box.H > pattern.MAX_PATTERN_SIZE {
+		return nil, fmt.Errorf("the pattern is %d x %d, but patterns can be "+
+			"up to %d x %d cells", box.W, box.H,
+			pattern.MAX_PATTERN_SIZE, pattern.MAX_PATTERN_SIZE)
+	}
+	cells := u.Buffer(box.X, box.Y, int(box.W), int(box.H))
+	p := pattern.New(int(box.W), int(box.H))
+	p.Rule = u.rule.String()
+	for y := 0; y < p.Height; y++ {
+		for x, v := range cells.Row(y) {
+			p.Set(x, y, v)
+		}
+	}
+	return p, nil
+}
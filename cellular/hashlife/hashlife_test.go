@@ -0,0 +1,180 @@
+package hashlife
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/fractalbach/fractalnet/cellular/engine"
+	"github.com/fractalbach/fractalnet/cellular/pattern"
+)
+
+// soup returns a bounded field with a square of random cells in the middle,
+// and enough empty space around it that nothing reaches the edge for margin
+// generations, so that it steps the same as on a plane with no edges.
+func soup(size, margin int, seed int64) *engine.Field {
+	r := rand.New(rand.NewSource(seed))
+	f := engine.NewField(size+2*margin, size+2*margin)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if r.Intn(3) == 0 {
+				f.Set(margin+x, margin+y, 1)
+			}
+		}
+	}
+	return f
+}
+
+func TestAdvanceMatchesStep(t *testing.T) {
+	const margin = 44
+	for _, rulestring := range []string{"B3/S23", "B36/S23", "B3678/S34678"} {
+		rule := engine.MustParseRule(rulestring)
+		for seed := int64(1); seed <= 3; seed++ {
+			src := soup(12, margin, seed)
+			dst := engine.NewField(src.Width(), src.Height())
+			u := FromBuffer(src.Buffer())
+			if err := u.SetRule(rule); err != nil {
+				t.Fatal(err)
+			}
+
+			// The jumps aren't powers of 2, so Advance has to put together
+			// a few jumps for each of them.
+			gen := 0
+			for _, n := range []int{1, 3, 7, 13, 6, 10} {
+				if err := u.Advance(int64(n)); err != nil {
+					t.Fatal(err)
+				}
+				for i := 0; i < n; i++ {
+					engine.Step(rule, src, dst, nil)
+					src, dst = dst, src
+				}
+				gen += n
+				got := u.Buffer(0, 0, src.Width(), src.Height())
+				if !bytes.Equal(got.Bytes(), src.Bytes()) {
+					t.Fatalf("%s, soup %d: generation %d doesn't match "+
+						"engine.Step", rulestring, seed, gen)
+				}
+				if u.Generation() != int64(gen) {
+					t.Errorf("%s, soup %d: Generation is %d, want %d",
+						rulestring, seed, u.Generation(), gen)
+				}
+				if u.Population() != int64(src.Count(1)) {
+					t.Errorf("%s, soup %d: Population is %d, want %d",
+						rulestring, seed, u.Population(), src.Count(1))
+				}
+			}
+		}
+	}
+}
+
+func mustPattern(t *testing.T, name string) *pattern.Pattern {
+	p, ok := pattern.Lookup(name)
+	if !ok {
+		t.Fatalf("there is no pattern called %q", name)
+	}
+	return p
+}
+
+func TestGlider(t *testing.T) {
+	glider := mustPattern(t, "glider")
+	u, err := FromPattern(glider)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A glider moves one cell down and to the right every 4 generations,
+	// and looks the same again.
+	for _, n := range []int64{4, 100, 1 << 20, 1 << 40} {
+		u, _ := FromPattern(glider)
+		if err := u.Advance(n); err != nil {
+			t.Fatal(err)
+		}
+		if u.Population() != 5 {
+			t.Errorf("after %d generations, the population is %d, want 5",
+				n, u.Population())
+		}
+		box, ok := u.BoundingBox()
+		want := Rect{X: n / 4, Y: n / 4, W: 3, H: 3}
+		if !ok || box != want {
+			t.Errorf("after %d generations, the bounding box is %+v, "+
+				"want %+v", n, box, want)
+		}
+		p, err := u.Pattern()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.PlainText() != glider.PlainText() {
+			t.Errorf("after %d generations, the pattern is\n%s\nwant\n%s",
+				n, p.PlainText(), glider.PlainText())
+		}
+	}
+
+	if u.Generation() != 0 || u.Population() != 5 {
+		t.Errorf("a new universe is at generation %d, with %d cells",
+			u.Generation(), u.Population())
+	}
+}
+
+func TestRPentomino(t *testing.T) {
+	u, err := FromPattern(mustPattern(t, "r-pentomino"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	box, ok := u.BoundingBox()
+	if want := (Rect{X: 0, Y: 0, W: 3, H: 3}); !ok || box != want {
+		t.Errorf("the bounding box is %+v, want %+v", box, want)
+	}
+
+	// The R-pentomino settles down at generation 1103, with 116 cells
+	// (including 6 gliders, which fly away forever).
+	if err := u.Advance(1103); err != nil {
+		t.Fatal(err)
+	}
+	if u.Population() != 116 {
+		t.Errorf("at generation 1103, the population is %d, want 116",
+			u.Population())
+	}
+	if err := u.Advance(100000 - 1103); err != nil {
+		t.Fatal(err)
+	}
+	if u.Population() != 116 {
+		t.Errorf("at generation 100000, the population is %d, want 116",
+			u.Population())
+	}
+	if box, _ := u.BoundingBox(); box.W < 100000/4 || box.H < 100000/4 {
+		t.Errorf("at generation 100000, the bounding box is only %+v, "+
+			"but the gliders should be far away", box)
+	}
+	if _, err := u.Pattern(); err == nil {
+		t.Errorf("Pattern made a pattern too big for a pattern file")
+	}
+}
+
+func TestEmptyUniverse(t *testing.T) {
+	u := New()
+	if _, ok := u.BoundingBox(); ok {
+		t.Errorf("an empty universe has a bounding box")
+	}
+	if err := u.Advance(1000); err != nil {
+		t.Fatal(err)
+	}
+	if u.Population() != 0 || u.Generation() != 1000 {
+		t.Errorf("an empty universe has %d cells at generation %d",
+			u.Population(), u.Generation())
+	}
+	if err := u.Advance(-1); err == nil {
+		t.Errorf("Advance went back a generation")
+	}
+}
+
+func TestSetRule(t *testing.T) {
+	u := New()
+	for _, bad := range []string{"B2/S/C3", "B2/S34H", "B03/S23"} {
+		if err := u.SetRule(engine.MustParseRule(bad)); err == nil {
+			t.Errorf("SetRule accepted %s", bad)
+		}
+	}
+	if err := u.SetRule(engine.MustParseRule("B36/S23")); err != nil {
+		t.Errorf("SetRule: %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package hashlife
+
+import (
+	"fmt"
+)
+
+// ===========================================================================
+//      Jumping Forward
+// ___________________________________________________________________________
+
+/*
+The future of a node of level k is its middle (a node of level k-1), moved
+forward by 2^j generations, for any j up to k-2.  It is put together from 9
+overlapping nodes of level k-1, each half of the node wide:
+
+        +---+---+---+---+
+        | 1 | 2 | 3 |   |       1 is the nw quadrant, 2 is the square
+        +---+---+---+---+       between nw and ne, 3 is ne, and so on,
+        | 4 | 5 | 6 |   |       down to 9 (se).  Each of them is 2 of
+        +---+---+---+---+       the little squares wide.
+        | 7 | 8 | 9 |   |
+        +---+---+---+---+
+        |   |   |   |   |
+        +---+---+---+---+
+
+The futures of those 9 are nodes of level k-2, which tile the middle of the
+node.  For a full jump (j = k-2), the 9 futures are moved forward by half of
+the jump each, and then joined into 4 nodes of level k-1, whose futures are
+moved forward by the other half.  For a smaller jump, the 9 futures already
+have all of the generations, and only their middles are joined together.
+
+At level 2, a node is 4x4 cells, and its future is the middle 2x2 cells
+after one generation, which the rule works out directly.
+*/
+
+// Step moves the universe forward by one generation.
+func (u *Universe) Step() error {
+	return u.Advance(1)
+}
+
+// Advance moves the universe forward by n generations.  It jumps by each
+// power of 2 in n, so it takes about as long as the number of bits in n.
+func (u *Universe) Advance(n int64) error {
+	if n < 0 {
+		return fmt.Errorf("can't go back %d generations", -n)
+	}
+	for j := uint(0); n>>j != 0; j++ {
+		if n>>j&1 == 0 {
+			continue
+		}
+		if err := u.AdvancePow2(j); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AdvancePow2 moves the universe forward by 2^j generations, in one jump.
+func (u *Universe) AdvancePow2(j uint) error {
+	if j >= MAX_LEVEL-2 {
+		return fmt.Errorf("can't jump by 2^%d generations at once", j)
+	}
+	if len(u.nodes) > MAX_NODES {
+		u.collect()
+	}
+
+	// The pattern needs room to grow by up to 2^j cells in every direction,
+	// so the root is grown until the pattern only fills its middle, and the
+	// middle is at least 2^j cells from the edge, and then once more.
+	for u.root.level < j+2 || !u.centred() {
+		if u.root.level >= MAX_LEVEL-1 {
+			return fmt.Errorf("the pattern is too big to jump by 2^%d "+
+				"generations", j)
+		}
+		u.expand()
+	}
+	u.expand()
+
+	quarter := int64(1) << (u.root.level - 2)
+	u.root = u.future(u.root, j)
+	u.x, u.y = u.x+quarter, u.y+quarter
+	u.generation += int64(1) << j
+	return nil
+}
+
+// centred reports whether every living cell is in the middle of the root,
+// the square that is half as wide.
+func (u *Universe) centred() bool {
+	r := u.root
+	return r.nw.pop == r.nw.se.pop && r.ne.pop == r.ne.sw.pop &&
+		r.sw.pop == r.sw.ne.pop && r.se.pop == r.se.nw.pop
+}
+
+// future returns the middle of the node, moved forward by 2^j generations.
+// The node must be at least of level j+2.
+func (u *Universe) future(n *node, j uint) *node {
+	if n.pop == 0 {
+		return u.emptyNode(n.level - 1)
+	}
+	if n.level == 2 {
+		return u.life4x4(n)
+	}
+	key := step{n, j}
+	if f, ok := u.futures[key]; ok {
+		return f
+	}
+
+	// Each of the 9 nodes can jump by at most 2^(k-3).
+	sub := j
+	if sub > n.level-3 {
+		sub = n.level - 3
+	}
+	a, b, c, d := n.nw, n.ne, n.sw, n.se
+	n1 := u.future(a, sub)
+	n2 := u.future(u.join(a.ne, b.nw, a.se, b.sw), sub)
+	n3 := u.future(b, sub)
+	n4 := u.future(u.join(a.sw, a.se, c.nw, c.ne), sub)
+	n5 := u.future(u.join(a.se, b.sw, c.ne, d.nw), sub)
+	n6 := u.future(u.join(b.sw, b.se, d.nw, d.ne), sub)
+	n7 := u.future(c, sub)
+	n8 := u.future(u.join(c.ne, d.nw, c.se, d.sw), sub)
+	n9 := u.future(d, sub)
+
+	var f *node
+	if j < n.level-2 {
+		f = u.join(
+			u.join(n1.se, n2.sw, n4.ne, n5.nw),
+			u.join(n2.se, n3.sw, n5.ne, n6.nw),
+			u.join(n4.se, n5.sw, n7.ne, n8.nw),
+			u.join(n5.se, n6.sw, n8.ne, n9.nw))
+	} else {
+		f = u.join(
+			u.future(u.join(n1, n2, n4, n5), sub),
+			u.future(u.join(n2, n3, n5, n6), sub),
+			u.future(u.join(n4, n5, n7, n8), sub),
+			u.future(u.join(n5, n6, n8, n9), sub))
+	}
+	u.futures[key] = f
+	return f
+}
+
+// life4x4 returns the middle 2x2 cells of a 4x4 node, one generation later.
+func (u *Universe) life4x4(n *node) *node {
+	var cells [4][4]bool
+	for y, row := range [2][2]*node{{n.nw, n.ne}, {n.sw, n.se}} {
+		for x, q := range row {
+			cells[2*y][2*x] = q.nw.pop > 0
+			cells[2*y][2*x+1] = q.ne.pop > 0
+			cells[2*y+1][2*x] = q.sw.pop > 0
+			cells[2*y+1][2*x+1] = q.se.pop > 0
+		}
+	}
+	next := func(x, y int) *node {
+		count := 0
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				if (dx != 0 || dy != 0) && cells[y+dy][x+dx] {
+					count++
+				}
+			}
+		}
+		alive := u.rule.Birth[count]
+		if cells[y][x] {
+			alive = u.rule.Survive[count]
+		}
+		if alive {
+			return u.alive
+		}
+		return u.dead
+	}
+	return u.join(next(1, 1), next(2, 1), next(1, 2), next(2, 2))
+}
+
+// collect forgets every node that isn't part of the pattern, and every
+// future, so that the memory can be used again.
+func (u *Universe) collect() {
+	u.nodes = map[quad]*node{}
+	u.futures = map[step]*node{}
+	var keep func(n *node)
+	keep = func(n *node) {
+		if n.level == 0 {
+			return
+		}
+		k := quad{n.nw, n.ne, n.sw, n.se}
+		if _, ok := u.nodes[k]; ok {
+			return
+		}
+		u.nodes[k] = n
+		keep(n.nw)
+		keep(n.ne)
+		keep(n.sw)
+		keep(n.se)
+	}
+	keep(u.root)
+	for _, e := range u.empty[1:] {
+		keep(e)
+	}
+}
@@ -0,0 +1,91 @@
+package pattern
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ===========================================================================
+//      Plain Text Patterns (.cells)
+// ___________________________________________________________________________
+
+/*
+A .cells file draws the pattern with a letter for each cell.  Comment lines
+start with !, and "!Name:" gives the pattern its name:
+
+        !Name: Glider
+        .O.
+        ..O
+        OOO
+
+A dot is a dead cell, and O is a living cell (some files use * instead).
+Rows can be shorter than the widest row; the missing cells are dead.
+*/
+
+// ParseCells reads a pattern in the plain text format.
+func ParseCells(text string) (*Pattern, error) {
+	var name string
+	var rows []string
+	width := 0
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if strings.HasPrefix(line, "!") {
+			if strings.HasPrefix(line, "!Name:") {
+				name = strings.TrimSpace(line[len("!Name:"):])
+			}
+			continue
+		}
+		rows = append(rows, line)
+		if len(line) > width {
+			width = len(line)
+		}
+	}
+
+	// Blank lines at the start and the end aren't part of the pattern.
+	for len(rows) > 0 && rows[len(rows)-1] == "" {
+		rows = rows[:len(rows)-1]
+	}
+	for len(rows) > 0 && rows[0] == "" {
+		rows = rows[1:]
+	}
+	if width > MAX_PATTERN_SIZE || len(rows) > MAX_PATTERN_SIZE {
+		return nil, fmt.Errorf("patterns can be up to %d x %d cells",
+			MAX_PATTERN_SIZE, MAX_PATTERN_SIZE)
+	}
+
+	p := New(width, len(rows))
+	p.Name = name
+	for y, row := range rows {
+		for x := 0; x < len(row); x++ {
+			switch row[x] {
+			case '.', ' ':
+			case 'O', 'o', '*':
+				p.Set(x, y, 1)
+			default:
+				return nil, fmt.Errorf("%q is not a cell in a .cells pattern; "+
+					"use . or O", row[x])
+			}
+		}
+	}
+	return p, nil
+}
+
+// PlainText returns the pattern in the plain text format.  Every cell that
+// isn't 0 is written as O, so the states of a multi-state pattern are lost.
+func (p *Pattern) PlainText() string {
+	var out strings.Builder
+	if p.Name != "" {
+		fmt.Fprintf(&out, "!Name: %s\n", p.Name)
+	}
+	for y := 0; y < p.Height; y++ {
+		for x := 0; x < p.Width; x++ {
+			if p.At(x, y) == 0 {
+				out.WriteByte('.')
+			} else {
+				out.WriteByte('O')
+			}
+		}
+		out.WriteByte('\n')
+	}
+	return out.String()
+}
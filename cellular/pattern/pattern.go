@@ -0,0 +1,252 @@
+// Package pattern reads and writes patterns of cells, in the formats that
+// Life programs like Golly use, so that shapes can be stamped onto a field
+// all at once, and parts of a field can be saved.
+package pattern
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fractalbach/fractalnet/cellular/engine"
+)
+
+// ===========================================================================
+//      Patterns
+// ___________________________________________________________________________
+
+/*
+A Pattern is a small rectangle of cells, like a stencil.  Cells that are 0
+are holes in the stencil: stamping the pattern leaves those cells of the
+field alone.  Two formats are understood:
+
+        .rle       Run Length Encoded, like "x = 3, y = 3\nbo$2bo$3o!".
+                   Cells can have up to 255 states.
+        .cells     Plain text, like ".O.\n..O\nOOO".  Cells are only dead
+                   (.) or alive (O).
+
+Both can start with comment lines, which can give the pattern a name.
+*/
+
+// MAX_PATTERN_SIZE is the widest or tallest pattern that can be read.  It
+// keeps a header like "x = 999999999" from using up all of the memory.
+const MAX_PATTERN_SIZE = 1024
+
+// Pattern is a rectangle of cells, row by row.
+type Pattern struct {
+
+	// Name and Rule come from the comments or the header of the file, and
+	// can be empty.
+	Name string
+	Rule string
+
+	Width, Height int
+
+	// cells has Width*Height values, row by row.
+	cells []uint8
+}
+
+// New returns an empty pattern of the given size.
+func New(w, h int) *Pattern {
+	if w < 0 {
+		w = 0
+	}
+	if h < 0 {
+		h = 0
+	}
+	return &Pattern{Width: w, Height: h, cells: make([]uint8, w*h)}
+}
+
+// At returns the cell at (x,y), or 0 if it is outside of the pattern.
+func (p *Pattern) At(x, y int) uint8 {
+	if x < 0 || y < 0 || x >= p.Width || y >= p.Height {
+		return 0
+	}
+	return p.cells[y*p.Width+x]
+}
+
+// Set changes the cell at (x,y).  Cells outside of the pattern are ignored.
+func (p *Pattern) Set(x, y int, v uint8) {
+	if x < 0 || y < 0 || x >= p.Width || y >= p.Height {
+		return
+	}
+	p.cells[y*p.Width+x] = v
+}
+
+// Count returns the number of cells that aren't 0.
+func (p *Pattern) Count() int {
+	n := 0
+	for _, v := range p.cells {
+		if v != 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// maxState returns the largest value of any cell.
+func (p *Pattern) maxState() uint8 {
+	var max uint8
+	for _, v := range p.cells {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+// Copy returns a copy of the pattern, which can be changed on its own.
+func (p *Pattern) Copy() *Pattern {
+	c := *p
+	c.cells = make([]uint8, len(p.cells))
+	copy(c.cells, p.cells)
+	return &c
+}
+
+// FromField copies the rectangle of w*h cells with its top left corner at
+// (x,y) out of the field.  The rectangle is cut down to fit in the field, so
+// it can be empty.
+func FromField(f *engine.Field, x, y, w, h int) *Pattern {
+	v := f.Buffer().View(x, y, w, h)
+	p := New(v.Width(), v.Height())
+	copy(p.cells, v.Bytes())
+	return p
+}
+
+// Parse reads a pattern in either format.  It is RLE if the first line
+// that isn't a comment is a header like "x = 3, y = 3".
+func Parse(text string) (*Pattern, error) {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+		if line[0] == 'x' && strings.Contains(line, "=") {
+			return ParseRLE(text)
+		}
+		break
+	}
+	return ParseCells(text)
+}
+
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+//      Rotating & Flipping
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+// ORIENTATIONS is the number of ways that a pattern can be turned around:
+// 4 rotations, each of them flipped or not.
+const ORIENTATIONS = 8
+
+// Orient returns a copy of the pattern, turned around.  The orientation is
+// a number from 0 to 7: 0 to 3 are the number of quarter turns clockwise,
+// and adding 4 flips the pattern left to right before it is turned.
+func (p *Pattern) Orient(orientation int) (*Pattern, error) {
+	if orientation < 0 || orientation >= ORIENTATIONS {
+		return nil, fmt.Errorf("the orientation must be between 0 and %d",
+			ORIENTATIONS-1)
+	}
+	q := p.Copy()
+	if orientation&4 != 0 {
+		q = q.flip()
+	}
+	for i := 0; i < orientation&3; i++ {
+		q = q.rotate()
+	}
+	return q, nil
+}
+
+// rotate returns the pattern turned a quarter turn clockwise.
+func (p *Pattern) rotate() *Pattern {
+	q := New(p.Height, p.Width)
+	q.Name, q.Rule = p.Name, p.Rule
+	for y := 0; y < p.Height; y++ {
+		for x := 0; x < p.Width; x++ {
+			q.Set(p.Height-1-y, x, p.At(x, y))
+		}
+	}
+	return q
+}
+
+// flip returns the pattern flipped left to right.
+func (p *Pattern) flip() *Pattern {
+	q := New(p.Width, p.Height)
+	q.Name, q.Rule = p.Name, p.Rule
+	for y := 0; y < p.Height; y++ {
+		for x := 0; x < p.Width; x++ {
+			q.Set(p.Width-1-x, y, p.At(x, y))
+		}
+	}
+	return q
+}
+
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+//      Named Patterns
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+var (
+	patternsMu sync.RWMutex
+	patterns   = map[string]*Pattern{}
+)
+
+// Register makes a pattern available by name, like engine.Register does
+// for rules.  Registering the same name twice panics.
+func Register(name string, p *Pattern) {
+	patternsMu.Lock()
+	defer patternsMu.Unlock()
+	if p == nil {
+		panic("pattern: Register pattern is nil")
+	}
+	if _, dup := patterns[name]; dup {
+		panic("pattern: Register called twice for pattern " + name)
+	}
+	patterns[name] = p.Copy()
+}
+
+// Lookup returns a copy of the pattern that was registered with the name.
+func Lookup(name string) (*Pattern, bool) {
+	patternsMu.RLock()
+	defer patternsMu.RUnlock()
+	p, ok := patterns[name]
+	if !ok {
+		return nil, false
+	}
+	return p.Copy(), true
+}
+
+// Names returns the names of every registered pattern, sorted.
+func Names() []string {
+	patternsMu.RLock()
+	defer patternsMu.RUnlock()
+	names := make([]string, 0, len(patterns))
+	for name := range patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// mustParse is Parse for the patterns that come with the package.
+func mustParse(text string) *Pattern {
+	p, err := Parse(text)
+	if err != nil {
+		panic("pattern: " + err.Error())
+	}
+	return p
+}
+
+func init() {
+	Register("block", mustParse("OO\nOO"))
+	Register("blinker", mustParse("OOO"))
+	Register("beehive", mustParse(".OO.\nO..O\n.OO."))
+	Register("glider", mustParse(".O.\n..O\nOOO"))
+	Register("lwss", mustParse(".O..O\nO....\nO...O\nOOOO."))
+	Register("r-pentomino", mustParse(".OO\nOO.\n.O."))
+	Register("acorn", mustParse(".O.....\n...O...\nOO..OOO"))
+	Register("pulsar", mustParse("x = 13, y = 13\n"+
+		"2b3o3b3o2b2$o4bobo4bo$o4bobo4bo$o4bobo4bo$2b3o3b3o2b2$"+
+		"2b3o3b3o2b$o4bobo4bo$o4bobo4bo$o4bobo4bo2$2b3o3b3o!"))
+	Register("gosper-gun", mustParse("x = 36, y = 9\n"+
+		"24bo$22bobo$12b2o6b2o12b2o$11bo3bo4b2o12b2o$2o8bo5bo3b2o$"+
+		"2o8bo3bob2o4bobo$10bo5bo7bo$11bo3bo$12b2o!"))
+}
@@ -0,0 +1,58 @@
+package pattern
+
+import (
+	"math"
+	"testing"
+
+	"github.com/fractalbach/fractalnet/cellular/engine"
+)
+
+func TestFromFieldOutOfRange(t *testing.T) {
+	f := engine.NewField(6, 5)
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 6; x++ {
+			f.Set(x, y, uint8(y*6+x+1))
+		}
+	}
+	tests := []struct {
+		name       string
+		x, y, w, h int
+		wantW      int
+		wantH      int
+	}{
+		{"inside", 1, 1, 3, 2, 3, 2},
+		{"past the edges", 4, 3, 10, 10, 2, 2},
+		{"before the edges", -1, -2, 3, 3, 2, 1},
+		{"negative size", 2, 2, -5, -5, 0, 0},
+		{"outside", 6, 5, 3, 3, 0, 0},
+		{"huge size", 2, 1, math.MaxInt64, math.MaxInt64, 4, 4},
+		{"huge negative corner", math.MinInt64, math.MinInt64,
+			math.MaxInt64, math.MaxInt64, 0, 0},
+		{"huge corner", math.MaxInt64, math.MaxInt64,
+			math.MaxInt64, math.MaxInt64, 0, 0},
+	}
+	for _, tt := range tests {
+		p := FromField(f, tt.x, tt.y, tt.w, tt.h)
+		if p.Width != tt.wantW || p.Height != tt.wantH {
+			t.Errorf("%s: FromField(%d, %d, %d, %d) is %d x %d, want %d x %d",
+				tt.name, tt.x, tt.y, tt.w, tt.h,
+				p.Width, p.Height, tt.wantW, tt.wantH)
+			continue
+		}
+		x0, y0 := tt.x, tt.y
+		if x0 < 0 {
+			x0 = 0
+		}
+		if y0 < 0 {
+			y0 = 0
+		}
+		for j := 0; j < p.Height; j++ {
+			for i := 0; i < p.Width; i++ {
+				if got, want := p.At(i, j), f.WhatIs(x0+i, y0+j); got != want {
+					t.Errorf("%s: cell (%d,%d) is %d, want %d",
+						tt.name, i, j, got, want)
+				}
+			}
+		}
+	}
+}
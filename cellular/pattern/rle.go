@@ -0,0 +1,251 @@
+package pattern
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ===========================================================================
+//      Run Length Encoded Patterns (.rle)
+// ___________________________________________________________________________
+
+/*
+An RLE file has comment lines that start with #, a header with the size of
+the pattern (and maybe its rule), and then the cells, row by row:
+
+        #N Glider
+        x = 3, y = 3, rule = B3/S23
+        bo$2bo$3o!
+
+Each tag can have a count in front of it, to repeat it:
+
+        b or .         a dead cell (0)
+        o              a living cell (1)
+        A to X         the states 1 to 24
+        pA to yO       the states 25 to 255, like "pA" = 25
+        $              the end of a row
+        !              the end of the pattern
+
+Cells that are missing at the end of a row are dead.
+*/
+
+// MAX_RLE_LINE is the longest line that Pattern.RLE writes.
+const MAX_RLE_LINE = 70
+
+// ParseRLE reads a pattern in the RLE format.
+func ParseRLE(text string) (*Pattern, error) {
+	var p *Pattern
+	var name string
+	var body strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case line[0] == '#':
+			if strings.HasPrefix(line, "#N") {
+				name = strings.TrimSpace(line[2:])
+			}
+		case p == nil:
+			var err error
+			p, err = parseRLEHeader(line)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			body.WriteString(line)
+		}
+	}
+	if p == nil {
+		return nil, fmt.Errorf("the RLE pattern has no header like " +
+			"\"x = 3, y = 3\"")
+	}
+	p.Name = name
+	if err := parseRLEBody(p, body.String()); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// parseRLEHeader reads a header like "x = 3, y = 3, rule = B3/S23", and
+// returns an empty pattern of that size.
+func parseRLEHeader(line string) (*Pattern, error) {
+	w, h := -1, -1
+	rule := ""
+	for _, part := range strings.Split(line, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("%q is not a header like \"x = 3, y = 3\"",
+				line)
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		var err error
+		switch key {
+		case "x":
+			w, err = strconv.Atoi(value)
+		case "y":
+			h, err = strconv.Atoi(value)
+		case "rule":
+			rule = value
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a size", value)
+		}
+	}
+	if w < 0 || h < 0 {
+		return nil, fmt.Errorf("%q needs both an x and a y", line)
+	}
+	if w > MAX_PATTERN_SIZE || h > MAX_PATTERN_SIZE {
+		return nil, fmt.Errorf("patterns can be up to %d x %d cells",
+			MAX_PATTERN_SIZE, MAX_PATTERN_SIZE)
+	}
+	p := New(w, h)
+	p.Rule = rule
+	return p, nil
+}
+
+// parseRLEBody fills in the cells of the pattern.
+func parseRLEBody(p *Pattern, body string) error {
+	x, y, count := 0, 0, 0
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c >= '0' && c <= '9' {
+			count = count*10 + int(c-'0')
+			if count > MAX_PATTERN_SIZE*MAX_PATTERN_SIZE {
+				return fmt.Errorf("the count %d is too large", count)
+			}
+			continue
+		}
+		n := count
+		if n == 0 {
+			n = 1
+		}
+		count = 0
+
+		var state int
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			continue
+		case c == '!':
+			return nil
+		case c == '$':
+			x, y = 0, y+n
+			continue
+		case c == 'b' || c == '.':
+			state = 0
+		case c == 'o':
+			state = 1
+		case c >= 'A' && c <= 'X':
+			state = int(c-'A') + 1
+		case c >= 'p' && c <= 'y':
+			i++
+			if i >= len(body) || body[i] < 'A' || body[i] > 'X' {
+				return fmt.Errorf("%q must be followed by a letter from A to X",
+					c)
+			}
+			state = 24*int(c-'p'+1) + int(body[i]-'A') + 1
+			if state > 255 {
+				return fmt.Errorf("%c%c is more than 255 states", c, body[i])
+			}
+		default:
+			return fmt.Errorf("%q is not a tag in an RLE pattern", c)
+		}
+		if x+n > p.Width || y >= p.Height {
+			return fmt.Errorf("the cells don't fit in %d x %d",
+				p.Width, p.Height)
+		}
+		for ; n > 0; n-- {
+			p.Set(x, y, uint8(state))
+			x++
+		}
+	}
+	return nil
+}
+
+// RLE returns the pattern in the RLE format.  Patterns with only dead and
+// living cells use b and o; others use . and the letters.
+func (p *Pattern) RLE() string {
+	var out strings.Builder
+	if p.Name != "" {
+		fmt.Fprintf(&out, "#N %s\n", p.Name)
+	}
+	fmt.Fprintf(&out, "x = %d, y = %d", p.Width, p.Height)
+	if p.Rule != "" {
+		fmt.Fprintf(&out, ", rule = %s", p.Rule)
+	}
+	out.WriteByte('\n')
+
+	multistate := p.maxState() > 1
+	line := 0
+	write := func(n int, tag string) {
+		run := tag
+		if n > 1 {
+			run = strconv.Itoa(n) + tag
+		}
+		if line+len(run) > MAX_RLE_LINE {
+			out.WriteByte('\n')
+			line = 0
+		}
+		out.WriteString(run)
+		line += len(run)
+	}
+
+	// Rows that end are only written once there is another living cell,
+	// so that empty rows at the end are left out, and runs of empty rows
+	// become a single "n$".
+	rows := 0
+	for y := 0; y < p.Height; y++ {
+		if p.rowIsEmpty(y) {
+			rows++
+			continue
+		}
+		if rows > 0 {
+			write(rows, "$")
+		}
+		rows = 1
+		for x := 0; x < p.Width; {
+			v := p.At(x, y)
+			n := 1
+			for x+n < p.Width && p.At(x+n, y) == v {
+				n++
+			}
+			if v != 0 || !p.restIsEmpty(x, y) {
+				write(n, rleTag(v, multistate))
+			}
+			x += n
+		}
+	}
+	write(1, "!")
+	out.WriteByte('\n')
+	return out.String()
+}
+
+// rleTag returns the tag for a cell value.
+func rleTag(v uint8, multistate bool) string {
+	switch {
+	case !multistate && v == 0:
+		return "b"
+	case !multistate:
+		return "o"
+	case v == 0:
+		return "."
+	case v <= 24:
+		return string([]byte{'A' + v - 1})
+	}
+	v -= 25
+	return string([]byte{'p' + v/24, 'A' + v%24})
+}
+
+func (p *Pattern) rowIsEmpty(y int) bool {
+	return p.restIsEmpty(0, y)
+}
+
+// restIsEmpty reports whether the row y is empty, from x to the end.
+func (p *Pattern) restIsEmpty(x, y int) bool {
+	for ; x < p.Width; x++ {
+		if p.At(x, y) != 0 {
+			return false
+		}
+	}
+	return true
+}
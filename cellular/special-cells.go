@@ -55,22 +55,12 @@ import (
 	"log"
 	"math/rand"
 	//"time"
+
+	"github.com/fractalbach/fractalnet/cellular/engine"
 )
 
 // Field represents a two-dimensional field of cells.
-type Field struct {
-	s    [][]uint8
-	w, h int
-}
-
-// Neighborhood represents the total color counts in the surrounding cells.
-func NewNeighborhood() map[uint8]uint8 {
-	return map[uint8]uint8{
-		1: 0, // Red
-		2: 0, // Green
-		3: 0, // Blue
-	}
-}
+type Field = engine.Field
 
 // WhoEatsMe returns the color that consumes the specified color, if nearby.
 // If will only return a 0 if it passes through all of the cases.
@@ -86,79 +76,31 @@ func WhoEatsMe(myColor uint8) uint8 {
 	return 0
 }
 
-// Abundance the color(s), which corresponds to a value [1-3],
-// and the number of counted neighbors of that color [0-8].
-// Since there could be a tie for the highest count,
-// multiple colors are returned in an array.
-func Abundance(neighborhood map[uint8]uint8) ([]uint8, uint8) {
-	var greatColor []uint8
-	var greatValue uint8
-	for k, v := range neighborhood {
-		if v == greatValue {
-			greatColor = append(greatColor, k)
-			continue
-		}
-		if v > greatValue {
-			greatColor = []uint8{k}
-			greatValue = v
-		}
-	}
-	return greatColor, greatValue
-}
-
 // NewField returns an empty field of the specified width and height.
 func NewField(w, h int) *Field {
-	s := make([][]uint8, h)
-	for i := range s {
-		s[i] = make([]uint8, w)
-	}
-	return &Field{s: s, w: w, h: h}
+	return engine.NewField(w, h)
 }
 
-// Set sets the state of the specified cell to the given value.
-func (f *Field) Set(x, y int, b uint8) {
-	f.s[y][x] = b
-}
+// Rule is the rule of the RGB game, where each color eats another one.
+type Rule struct{}
 
-// WhatsIs reports the number that is at the specified cell.
-// NOTE: THIS WRAPS AROUND THE MAP.
-func (f *Field) WhatIs(x, y int) uint8 {
-	//x += f.w
-	//x %= f.w
-	//y += f.h
-	//y %= f.h
-	if (x < 0) || (y < 0) || (x >= f.w) || (y >= f.h) {
-		return 0
-	}
-	return f.s[y][x]
+func (Rule) Neighbors() []engine.Offset {
+	return engine.Moore
 }
 
-// Next returns the state of the specified cell at the next time step.
-func (f *Field) Next(x, y int) uint8 {
-	// Count the adjacent cells that are alive.
-	n := NewNeighborhood()
-	for i := -1; i <= 1; i++ {
-		for j := -1; j <= 1; j++ {
-			if j != 0 || i != 0 {
-				switch f.WhatIs(x+i, y+j) {
-				case 1:
-					n[1]++
-				case 2:
-					n[2]++
-				case 3:
-					n[3]++
-				}
-			}
-		}
-	}
+// Next returns the state of the cell at the next time step.
+func (Rule) Next(nb *engine.Neighborhood) uint8 {
+	// Count the adjacent cells of each color, straight from the counts of
+	// the neighborhood, so that nothing is allocated.
+	n := func(color uint8) int { return nb.Count(color) }
 	// Return next state according to the game rules:
-	me := f.WhatIs(x, y)
+	me := nb.Me
 
 	// Rules if you are an empty square. Contested squares are not filled.
 	if me == 0 {
-		greatColors, greatValue := Abundance(n)
-		if ((greatValue == 3) || (greatValue == 5)) && len(greatColors) == 1 {
-			return greatColors[0]
+		greatColor, greatValue, unique := nb.Most(1, 3)
+		if ((greatValue == 3) || (greatValue == 5)) && unique {
+			return greatColor
 		} else {
 			return 0
 		}
@@ -167,44 +109,49 @@ func (f *Field) Next(x, y int) uint8 {
 	// Find out what color you are, and what color your enemy is.
 	enemy := WhoEatsMe(me)
 
-	if n[enemy] >= 5 {
+	if n(enemy) >= 5 {
 		return enemy
 	}
 
-	totalN := n[1] + n[2] + n[3]
+	totalN := n(1) + n(2) + n(3)
 	if totalN > 5 {
 		return 0
 	}
 
-	if n[enemy] >= 2 {
+	if n(enemy) >= 2 {
 		return enemy
 	}
 
 	// If no enemies are nearby, and you have 2 or 3 allies, you stay.
 
-	if (n[me] == 3) || (n[me] == 2) {
+	if (n(me) == 3) || (n(me) == 2) {
 		return me
 	}
 
 	// If an enemy is nearby, then it will consume your square.
-	if n[enemy] == 1 {
+	if n(enemy) == 1 {
 		return enemy
 	}
 
 	return 0
 }
 
+func init() {
+	engine.Register("rgb", Rule{})
+}
+
 // Life stores the state of a round of Conway's Game of Life.
 type Life struct {
 	a, b *Field
 	w, h int
 }
 
-// NewLife returns a new Life game state with a random initial state.
-func NewLife(w, h int) *Life {
+// NewLife returns a new Life game state with a random initial state, made
+// by the given random number generator.
+func NewLife(w, h int, rng *rand.Rand) *Life {
 	a := NewField(w, h)
 	for i := 0; i < (w * h / 1); i++ {
-		a.Set(rand.Intn(w), rand.Intn(h), uint8(rand.Intn(4)))
+		a.Set(rng.Intn(w), rng.Intn(h), uint8(rng.Intn(4)))
 	}
 	return &Life{
 		a: a, b: NewField(w, h),
@@ -215,11 +162,7 @@ func NewLife(w, h int) *Life {
 // Step advances the game by one instant, recomputing and updating all cells.
 func (l *Life) Step() {
 	// Update the state of the next field (b) from the current field (a).
-	for y := 0; y < l.h; y++ {
-		for x := 0; x < l.w; x++ {
-			l.b.Set(x, y, l.a.Next(x, y))
-		}
-	}
+	engine.Step(Rule{}, l.a, l.b, nil)
 	// Swap fields a and b.
 	l.a, l.b = l.b, l.a
 }
@@ -257,15 +200,11 @@ type GridState struct {
 	GridState string
 }
 
-// encodeFieldData converts the field of cells into an array, then encodes
-// them in base64.  Then, it is encapsulated in a json message called
+// encodeFieldData encodes the cells of the field in base64, straight from
+// the field's own buffer.  Then, it is encapsulated in a json message called
 // "GridState".  The JSON is returned in the form of a byte array.
-func (f *Field) encodeFieldData() []byte {
-	arr := []byte{}
-	for _, v := range f.s {
-		arr = append(arr, v...)
-	}
-	b64 := base64.StdEncoding.EncodeToString(arr)
+func encodeFieldData(f *Field) []byte {
+	b64 := base64.StdEncoding.EncodeToString(f.Bytes())
 	msg, err := json.Marshal(GridState{b64})
 	if err != nil {
 		log.Println(err)
@@ -276,7 +215,7 @@ func (f *Field) encodeFieldData() []byte {
 
 // LifeStateMessage returns an encoded Json message, ready to be sent.
 func (l *Life) LifeStateMessage() []byte {
-	return l.a.encodeFieldData()
+	return encodeFieldData(l.a)
 }
 
 // AlterAt changes the value at a specific position of the field.
@@ -292,11 +231,11 @@ func (l *Life) AlterAt(x, y int, val uint8) {
 func main() {
 	iters := 100
 
-	l := NewLife(48, 48)
+	l := NewLife(48, 48, rand.New(rand.NewSource(1)))
 	for i := 0; i < iters; i++ {
 		l.Step()
 		fmt.Print("\x0c") // Clear screen and print field.
-		x := l.a.encodeFieldData()
+		x := encodeFieldData(l.a)
 		fmt.Println(len(x))
 		fmt.Println(string(x)[:100])
 		fmt.Print(l)
@@ -2,13 +2,14 @@ package wave
 
 import (
 	"bytes"
-	crand "crypto/rand"
 	"encoding/base64"
 	"encoding/json"
 	"log"
 	"math/rand"
 	//"fmt"
 	//"time"
+
+	"github.com/fractalbach/fractalnet/cellular/engine"
 )
 
 var (
@@ -16,20 +17,7 @@ var (
 )
 
 // Field represents a two-dimensional field of cells.
-type Field struct {
-	s    [][]uint8
-	w, h int
-}
-
-// Neighborhood represents the total color counts in the surrounding cells.
-func NewNeighborhood() map[uint8]uint8 {
-	return map[uint8]uint8{
-		0: 0, // Empty
-		1: 0, // Red
-		2: 0, // Green
-		3: 0, // Blue
-	}
-}
+type Field = engine.Field
 
 // WhoEatsMe returns the color that consumes the specified color, if nearby.
 // If will only return a 0 if it passes through all of the cases.
@@ -45,107 +33,63 @@ func WhoEatsMe(myColor uint8) uint8 {
 	return 0
 }
 
-// Abundance the color(s), which corresponds to a value [1-3],
-// and the number of counted neighbors of that color [0-8].
-// Since there could be a tie for the highest count,
-// multiple colors are returned in an array.
-func Abundance(neighborhood map[uint8]uint8) ([]uint8, uint8) {
-	var greatColor []uint8
-	var greatValue uint8
-	for k, v := range neighborhood {
-		if v == greatValue {
-			greatColor = append(greatColor, k)
-			continue
-		}
-		if v > greatValue {
-			greatColor = []uint8{k}
-			greatValue = v
-		}
-	}
-	return greatColor, greatValue
-}
-
 // NewField returns an empty field of the specified width and height.
 func NewField(w, h int) *Field {
-	s := make([][]uint8, h)
-	for i := range s {
-		s[i] = make([]uint8, w)
-	}
-	return &Field{s: s, w: w, h: h}
+	return engine.NewField(w, h)
 }
 
-// Set sets the state of the specified cell to the given value.
-func (f *Field) Set(x, y int, b uint8) {
-	f.s[y][x] = b
-}
+// Rule is the rule of the wave game.  Each cell looks at the 8 cells around
+// it, and at the 4 cells that are 2 squares away in each direction.
+type Rule struct{}
 
-// WhatsIs reports the number that is at the specified cell.
-// NOTE: THIS WRAPS AROUND THE MAP.
-func (f *Field) WhatIs(x, y int) uint8 {
-	//x += f.w
-	//x %= f.w
-	//y += f.h
-	//y %= f.h
-	if (x < 0) || (y < 0) || (x >= f.w) || (y >= f.h) {
-		return 0
-	}
-	return f.s[y][x]
-}
-
-// Next returns the state of the specified cell at the next time step.
-func (f *Field) Next(x, y int) uint8 {
-	// Count the adjacent cells that are alive.
-	n := NewNeighborhood()
-	for _, i := range []int{-1, 0, 1} {
-		for _, j := range []int{-1, 0, 1} {
-			if j != 0 || i != 0 {
-				val := f.WhatIs(x+i, y+j)
-				if val != 0 {
-					n[val]++
-				}
-			}
-		}
-	}
-	q := []uint8{
-		f.WhatIs(x+2, y),
-		f.WhatIs(x-2, y),
-		f.WhatIs(x, y+2),
-		f.WhatIs(x, y-2),
-	}
-	for _, val := range q {
-		if val != 0 {
-			n[val]++
-		}
-	}
+func (Rule) Neighbors() []engine.Offset {
+	return engine.MooreAndCross
+}
 
+// Next returns the state of the cell at the next time step.  It only uses
+// the counts that the neighborhood already has, so it doesn't allocate.
+func (Rule) Next(nb *engine.Neighborhood) uint8 {
 	// Return next state according to the game rules:
-	me := f.WhatIs(x, y)
+	me := nb.Me
 	enemy := WhoEatsMe(me)
 
-	if n[enemy] >= 3 {
+	if alive(nb, enemy) >= 3 {
 		return enemy
 	}
-	if (n[me] == 2) || (n[me] == 3) || (n[me] == 5) {
+	if n := alive(nb, me); (n == 2) || (n == 3) || (n == 5) {
 		return me
 	}
-	greatColors, greatValue := Abundance(n)
-	if greatValue >= 0 && len(greatColors) == 1 {
-		return greatColors[0]
+	if greatColor, _, unique := nb.Most(1, uint8(MAX_VAL)); unique {
+		return greatColor
 	}
 	return me
 }
 
+// alive returns the number of nearby cells of a color.  Empty cells aren't
+// counted, so there are never any nearby cells of color 0.
+func alive(nb *engine.Neighborhood, color uint8) int {
+	if color == 0 {
+		return 0
+	}
+	return nb.Count(color)
+}
+
+func init() {
+	engine.Register("wave", Rule{})
+}
+
 // Life stores the state of a round of Conway's Game of Life.
 type Life struct {
 	a, b *Field
 	w, h int
 }
 
-// NewLife returns a new Life game state with a random initial state.
-func NewLife(w, h int) *Life {
+// NewLife returns a new Life game state with a random initial state, made
+// by the given random number generator.
+func NewLife(w, h int, rng *rand.Rand) *Life {
 	a := NewField(w, h)
 	for i := 0; i < (w * h / 1); i++ {
-		a.Set(rand.Intn(w), rand.Intn(h), uint8(gimmeRandom(4)))
+		a.Set(rng.Intn(w), rng.Intn(h), uint8(rng.Intn(4)))
 	}
 	return &Life{
 		a: a, b: NewField(w, h),
@@ -156,11 +100,7 @@ func NewLife(w, h int) *Life {
 // Step advances the game by one instant, recomputing and updating all cells.
 func (l *Life) Step() {
 	// Update the state of the next field (b) from the current field (a).
-	for y := 0; y < l.h; y++ {
-		for x := 0; x < l.w; x++ {
-			l.b.Set(x, y, l.a.Next(x, y))
-		}
-	}
+	engine.Step(Rule{}, l.a, l.b, nil)
 	// Swap fields a and b.
 	l.a, l.b = l.b, l.a
 }
@@ -200,15 +140,11 @@ type GridState struct {
 	GridState string
 }
 
-// encodeFieldData converts the field of cells into an array, then encodes
-// them in base64.  Then, it is encapsulated in a json message called
+// encodeFieldData encodes the cells of the field in base64, straight from
+// the field's own buffer.  Then, it is encapsulated in a json message called
 // "GridState".  The JSON is returned in the form of a byte array.
-func (f *Field) encodeFieldData() []byte {
-	arr := []byte{}
-	for _, v := range f.s {
-		arr = append(arr, v...)
-	}
-	b64 := base64.StdEncoding.EncodeToString(arr)
+func encodeFieldData(f *Field) []byte {
+	b64 := base64.StdEncoding.EncodeToString(f.Bytes())
 	msg, err := json.Marshal(GridState{b64})
 	if err != nil {
 		log.Println(err)
@@ -219,28 +155,32 @@ func (f *Field) encodeFieldData() []byte {
 
 // LifeStateMessage returns an encoded Json message, ready to be sent.
 func (l *Life) LifeStateMessage() []byte {
-	return l.a.encodeFieldData()
+	return encodeFieldData(l.a)
 }
 
-// AlterAt changes the value at a specific position of the field.
+// AlterAt changes the value at a specific position of the field.  On a
+// torus, positions past the edge wrap around to the other side.
 func (l *Life) AlterAt(x, y int, val uint8) {
-	if (x < 0) || (y < 0) || (x >= l.w) || (y >= l.h) || (val > 3) {
+	x, y, ok := l.a.Wrap(x, y)
+	if !ok || (val > 3) {
 		return
 	}
 	l.a.Set(x, y, val)
 }
 
-func gimmeRandom(max int) int {
-	a := make([]byte, 1)
-	crand.Read(a)
-	return int(a[0]) % max
+// SetTopology changes what the cells see past the edges of the field.
+func (l *Life) SetTopology(t string) error {
+	if err := l.a.SetTopology(t); err != nil {
+		return err
+	}
+	return l.b.SetTopology(t)
 }
 
 /*
 func main() {
 	iters := 100
 
-	l := NewLife(60, 30)
+	l := NewLife(60, 30, rand.New(rand.NewSource(1)))
 	for i := 0; i < iters; i++ {
 		l.Step()
 		fmt.Print("\x0c") // Clear screen and print field.
@@ -1,20 +1,71 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
-	//"os"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/fractalbach/fractalnet/cellular/hashlife"
+	"github.com/fractalbach/fractalnet/cellular/pattern"
+	"github.com/fractalbach/fractalnet/game"
 	"github.com/fractalbach/fractalnet/wschat"
 )
 
 var addr = flag.String("a", "localhost:8080", "http service address")
+var snapshotPath = flag.String("snapshot", "snapshot.json",
+	"file where the game rooms are saved on shutdown, and loaded on startup")
+var configPath = flag.String("config", "",
+	"json config file; flags given on the command line override it")
+var replayPath = flag.String("replay", "",
+	"journal file of a room; prints the board at -replay-tick, and exits")
+var replayTick = flag.Int("replay-tick", -1,
+	"tick to replay the journal to (-1 is the end of the journal)")
+var analyzePath = flag.String("analyze", "",
+	"pattern file (.rle or .cells) or pattern name; runs it with HashLife, "+
+		"prints it at -analyze-gens, and exits")
+var analyzeGens = flag.Int64("analyze-gens", 1000,
+	"number of generations to run the pattern for")
 
 func main() {
 	log.Println("Starting up Fractal Game Net...")
+
+	// The config flags are defined here, so that they show up in -help with
+	// their defaults.  They are copied over the config file after parsing.
+	wschat.DefaultConfig().AddFlags(flag.CommandLine)
 	flag.Parse()
+
+	if *replayPath != "" {
+		replay(*replayPath, *replayTick)
+		return
+	}
+	if *analyzePath != "" {
+		analyze(*analyzePath, *analyzeGens)
+		return
+	}
+
+	config, err := wschat.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := config.ApplyFlags(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+	if err := config.Validate(); err != nil {
+		log.Fatal("Invalid config: ", err)
+	}
+	shown := *config
+	if shown.AdminPassword != "" {
+		shown.AdminPassword = "(hidden)"
+	}
+	log.Printf("Config: %+v", shown)
 	/*
 		addr := "localhost:8080"
 
@@ -25,8 +76,14 @@ func main() {
 		}*/
 
 	log.Println("Starting Websocket Hub...")
-	hub := wschat.NewHub()
-	go hub.Run()
+	hub := wschat.NewHub(config)
+
+	log.Println("Loading Snapshot from", *snapshotPath)
+	snap, err := wschat.LoadSnapshot(*snapshotPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	hub.Restore(snap)
 
 	/*
 		Create a Custom Server Multiplexer
@@ -53,7 +110,93 @@ func main() {
 	}
 
 	log.Println("Listening and Serving on ", (*addr))
-	log.Fatal(s.ListenAndServe())
+	go func() {
+		err := s.ListenAndServe()
+		if err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// Wait for a signal to shut down.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	sig := <-stop
+	log.Println("Received", sig, "- Shutting down...")
+
+	// Stop accepting new connections.  The websocket connections have been
+	// taken over from the server, so the hub closes those.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		log.Println(err)
+	}
+
+	snap = hub.Shutdown("The server is restarting.")
+	log.Println("Saving Snapshot to", *snapshotPath)
+	if err := wschat.SaveSnapshot(*snapshotPath, snap); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("Goodbye.")
+}
+
+// replay prints the events that happened on a tick of a room's journal, and
+// the board after them.
+func replay(path string, tick int) {
+	entries, err := game.ReadJournal(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if tick < 0 && len(entries) > 0 {
+		tick = entries[len(entries)-1].Tick
+	}
+	w, err := game.Replay(entries, tick)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Tick == tick && e.Start == nil {
+			b, _ := json.Marshal(e)
+			fmt.Println(string(b))
+		}
+	}
+	fmt.Printf("Tick %d, Rule %s, Topology %s\n",
+		w.War.Tick(), w.War.Rule(), w.War.Topology())
+	fmt.Print(w.War.String())
+}
+
+// analyze runs a pattern for a number of generations with HashLife, and
+// prints its population and bounding box, and the pattern if it is small.
+func analyze(path string, gens int64) {
+	p, ok := pattern.Lookup(path)
+	if !ok {
+		text, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if p, err = pattern.Parse(string(text)); err != nil {
+			log.Fatal(err)
+		}
+	}
+	u, err := hashlife.FromPattern(p)
+	if err != nil {
+		log.Fatal(err)
+	}
+	start := time.Now()
+	if err := u.Advance(gens); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Generation %d, Rule %s, Population %d (%v, %d nodes)\n",
+		u.Generation(), u.Rule(), u.Population(), time.Since(start),
+		u.Nodes())
+	box, ok := u.BoundingBox()
+	if !ok {
+		fmt.Println("Everything died.")
+		return
+	}
+	fmt.Printf("Bounding box: %d x %d, at (%d, %d)\n", box.W, box.H, box.X, box.Y)
+	if out, err := u.Pattern(); err == nil {
+		fmt.Print(out.RLE())
+	}
 }
 
 /*
@@ -1,8 +1,8 @@
 package game
 
 import (
-	"crypto/rand"
 	"errors"
+	"math/rand"
 )
 
 /*
@@ -11,9 +11,10 @@ Example For using Bool Grids Compression
     https://play.golang.org/p/_2nSGJHF2Sy
 */
 
-func MakeRandomByteGrid(w, h int) [][]byte {
+// MakeRandomByteGrid returns a grid of random bytes from rng.
+func MakeRandomByteGrid(w, h int, rng *rand.Rand) [][]byte {
 	x := make([]byte, h*w)
-	rand.Read(x)
+	rng.Read(x)
 	grid := make([][]byte, w)
 	for i := range grid {
 		grid[i] = x[h*i : h*(i+1)]
@@ -21,8 +22,9 @@ func MakeRandomByteGrid(w, h int) [][]byte {
 	return grid
 }
 
-func MakeRandomBoolGrid(w, h int) [][]bool {
-	g := MakeRandomByteGrid(w, h)
+// MakeRandomBoolGrid returns a grid where about half of the cells are true.
+func MakeRandomBoolGrid(w, h int, rng *rand.Rand) [][]bool {
+	g := MakeRandomByteGrid(w, h, rng)
 	out := make([][]bool, w)
 	for i := range g {
 		out[i] = make([]bool, h)
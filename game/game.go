@@ -3,13 +3,19 @@ package game
 import (
 	//"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"github.com/fractalbach/fractalnet/cellular/gameofwar"
+	"github.com/fractalbach/fractalnet/cellular/pattern"
+	"github.com/fractalbach/fractalnet/namegen"
 	"log"
-)
+	"math/rand"
+	"strings"
+	"time"
 
-var (
-	GAME_WORLD_WIDTH  = 48
-	GAME_WORLD_HEIGHT = 48
+	// These packages register their rules with the engine, so that a world
+	// can be played with them.
+	_ "github.com/fractalbach/fractalnet/cellular"
+	_ "github.com/fractalbach/fractalnet/cellular/wave"
 )
 
 type World struct {
@@ -22,11 +28,77 @@ type World struct {
 
 	// private variables include the ID counter (nextid) and map dimensions.
 	nextid, w, h int
+
+	// announcements are messages for everyone in the room, which are waiting
+	// to be picked up with the "Announcements" event.
+	announcements [][]byte
+
+	// score is the territory of each team, and budgets are their resources
+	// and cooldowns, as they were last announced.
+	score   gameofwar.Score
+	budgets gameofwar.Budgets
+
+	// rng is the only source of randomness in the world: the boards of the
+	// Game of War, and the names of guests.  seed is what it started with,
+	// and source counts the numbers that have been drawn from it.
+	rng    *rand.Rand
+	seed   int64
+	source *countingSource
+
+	// settings are the ones that the world was made or restored with.
+	settings Settings
 }
 
+// Settings are chosen by the server when a new world is made.
+type Settings struct {
+	Width, Height int
+
+	// Rule is the name of the cellular automaton rule that the grid follows.
+	// If it is empty, then the Game of War rule is used.
+	Rule string
+
+	// Topology decides what is past the edges of the grid: "bounded",
+	// "torus" or "mirror".  If it is empty, then the grid is bounded.
+	Topology string
+
+	// Victory decides when a round of the Game of War is over.
+	Victory gameofwar.VictoryConditions
+
+	// Economy sets the prices of bombs, and the income of each team.
+	Economy gameofwar.Economy
+
+	// Seed starts the world's random number generator.  Worlds with the same
+	// seed make the same boards and guest names.  If it is 0, then a seed is
+	// picked from the time.
+	Seed int64
+
+	// SnapshotDir is the directory where admins save named snapshots of the
+	// world, with "SaveSnapshot".  If it is empty, then they can't.
+	SnapshotDir string
+}
+
+// MAX_STEPS_PER_EVENT limits how far a single "Step" event can move the game.
+const MAX_STEPS_PER_EVENT = 100
+
+// MAX_PATTERN_CELLS limits the number of cells that a player can place with
+// a single "PlacePattern" event.
+const MAX_PATTERN_CELLS = 1000
+
+// MAX_WORLD_SIZE is the widest or tallest that a world can be.  The grid
+// takes a byte per cell (and the Game of War keeps two of them), so this
+// keeps a world under about 32MB, and its full frames small enough to send
+// to a client.
+const MAX_WORLD_SIZE = 4096
+
+// MAX_RNG_DRAWS limits how far the random number generator of a restored
+// world is moved forward, since every number has to be drawn again.  See
+// countingSource.skipTo.
+const MAX_RNG_DRAWS = 1 << 30
+
 type Ent struct {
 	Name     string
 	Type     string
+	Team     uint8
 	Location Location
 }
 
@@ -42,18 +114,97 @@ type TreeState struct {
 // 		Creating a new World
 // ------------------------------------------------------
 
-func MakeNewWorld() *World {
-	return &World{
-		Ents:   map[int]*Ent{},
-		nextid: 1,
-		h:      GAME_WORLD_HEIGHT,
-		w:      GAME_WORLD_WIDTH,
-		War:    gameofwar.NewGameInstance(GAME_WORLD_WIDTH, GAME_WORLD_HEIGHT),
-		//Trees:  CreateRandomInitialTrees(48, 48),
-		//LifeGrid: wave.NewLife(GAME_WORLD_WIDTH, GAME_WORLD_HEIGHT),
+// MakeNewWorld creates an empty world, with the given settings.
+func MakeNewWorld(s Settings) *World {
+	seed := pickSeed(s.Seed)
+	source := newCountingSource(seed)
+	rng := rand.New(source)
+	w := &World{
+		Ents:     map[int]*Ent{},
+		nextid:   1,
+		h:        s.Height,
+		w:        s.Width,
+		rng:      rng,
+		seed:     seed,
+		source:   source,
+		settings: s,
+		War:      gameofwar.NewGameInstance(s.Width, s.Height, rng),
+		//Trees:  CreateRandomInitialTrees(48, 48, rng),
+		//LifeGrid: wave.NewLife(s.Width, s.Height, rng),
+	}
+	w.War.SetVictoryConditions(s.Victory)
+	w.War.SetEconomy(s.Economy)
+	if s.Rule != "" {
+		if err := w.War.SetRule(s.Rule); err != nil {
+			log.Println("MakeNewWorld:", err)
+		}
+	}
+	if err := w.War.SetTopology(s.Topology); err != nil {
+		log.Println("MakeNewWorld:", err)
+	}
+	return w
+}
+
+// pickSeed returns the seed, or a seed from the time if it is 0.
+func pickSeed(seed int64) int64 {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return seed
+}
+
+// countingSource is the source of a world's random numbers.  It counts the
+// numbers that are drawn, so that a snapshot can save how far it has gotten.
+type countingSource struct {
+	src   rand.Source64
+	draws uint64
+}
+
+// newCountingSource starts a source from the seed.
+func newCountingSource(seed int64) *countingSource {
+	return &countingSource{src: rand.NewSource(seed).(rand.Source64)}
+}
+
+// skipTo draws numbers until the given number of them have been drawn, so
+// that the source picks up where a saved one left off.  It doesn't matter
+// who drew the numbers that were drawn already, since they all came out of
+// the same sequence.
+//
+// Moving forward more than MAX_RNG_DRAWS would take too long, so then the
+// source is seeded from both the seed and the draws instead.  It won't pick
+// the same numbers as before, but it is very unlikely to repeat them.
+func (s *countingSource) skipTo(seed int64, draws uint64) {
+	if draws > MAX_RNG_DRAWS {
+		s.Seed(seed ^ int64(draws))
+		s.draws = draws
+		return
+	}
+	for s.draws < draws {
+		s.Int63()
 	}
 }
 
+func (s *countingSource) Int63() int64 {
+	s.draws++
+	return s.src.Int63()
+}
+
+func (s *countingSource) Uint64() uint64 {
+	s.draws++
+	return s.src.Uint64()
+}
+
+func (s *countingSource) Seed(seed int64) {
+	s.src.Seed(seed)
+	s.draws = 0
+}
+
+// Seed returns the seed that the world's random number generator started
+// with.
+func (w *World) Seed() int64 {
+	return w.seed
+}
+
 // ______________________________________________________
 // 		Manipulating the World
 // ------------------------------------------------------
@@ -74,13 +225,56 @@ func (w *World) makeNextId() int {
 
 func (w *World) generatePlayer(username string) (int, bool) {
 	id := w.makeNextId()
-	ok := w.addEntity(&Ent{Name: username, Type: "player"}, id)
+	e := &Ent{Name: username, Type: "player", Team: w.smallestTeam()}
+	ok := w.addEntity(e, id)
 	if ok {
 		return id, true
 	}
 	return 0, false
 }
 
+// smallestTeam returns the team that has the fewest players, so that new
+// players are spread evenly between team 1 and team 2.
+func (w *World) smallestTeam() uint8 {
+	count := map[uint8]int{}
+	for _, e := range w.Ents {
+		if e.Type == "player" {
+			count[e.Team]++
+		}
+	}
+	if count[gameofwar.TEAM_2] < count[gameofwar.TEAM_1] {
+		return gameofwar.TEAM_2
+	}
+	return gameofwar.TEAM_1
+}
+
+// checkPlayerValue makes sure that a player is only placing squares of their
+// own team.  A value of 0 is rewritten into the player's team value.
+// Events that did not come from a player are not checked.
+//
+// If the value is not allowed, then an EventError explains why.
+func (w *World) checkPlayerValue(a *AbstractEvent, v *uint8) *EventError {
+	if a.SourceType != "Player" {
+		return nil
+	}
+	e, ok := w.Ents[a.SourceId]
+	if !ok || !gameofwar.IsTeam(e.Team) {
+		return a.NewError(ErrNotOnTeam, "You are not on a team.")
+	}
+	if *v == 0 {
+		*v = e.Team
+	}
+	if !gameofwar.IsTeam(*v) {
+		return a.NewError(ErrIllegalValue,
+			fmt.Sprintf("%d is not a value that players can place.", *v))
+	}
+	if *v != e.Team {
+		return a.NewError(ErrWrongTeam,
+			fmt.Sprintf("You are on team %d, not team %d.", e.Team, *v))
+	}
+	return nil
+}
+
 func (w *World) changeEntityLocation(id, x, y int) bool {
 	if _, ok := w.Ents[id]; ok {
 		w.Ents[id].Location.Set(x, y)
@@ -117,10 +311,197 @@ func (w *World) stateAllEntities() []byte {
 	return b
 }
 
+// checkGameOver announces the end of the round, if it has just finished.
+func (w *World) checkGameOver() {
+	result := w.War.TakeGameOver()
+	if result == nil {
+		return
+	}
+	log.Println("Game Over: Winner:", result.Winner, "Reason:", result.Reason,
+		"Score:", result.Score.Team1, "to", result.Score.Team2)
+	b, err := json.Marshal(GameOverMessage{*result})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	w.announce(b)
+	w.announce(w.roundMessage())
+}
+
+// updateScore announces the territory and the budget of each team, if
+// either of them has changed.
+func (w *World) updateScore() {
+	s, b := w.War.Territory(), w.War.Budgets()
+	if s == w.score && b == w.budgets {
+		return
+	}
+	w.score, w.budgets = s, b
+	w.announce(w.scoreMessage())
+}
+
+// scoreMessage returns a ScoreMessage with the territory and the budget of
+// each team.
+func (w *World) scoreMessage() []byte {
+	b, err := json.Marshal(ScoreMessage{
+		Score:  w.War.Territory(),
+		Budget: w.War.Budgets(),
+		Tick:   w.War.Tick(),
+	})
+	if err != nil {
+		log.Println(err)
+		return []byte{}
+	}
+	return b
+}
+
+// roundMessage returns a RoundMessage with the state of the current round.
+func (w *World) roundMessage() []byte {
+	b, err := json.Marshal(RoundMessage{w.War.Round()})
+	if err != nil {
+		log.Println(err)
+		return []byte{}
+	}
+	return b
+}
+
+// announce queues a message for everyone in the room.
+func (w *World) announce(msg []byte) {
+	if len(msg) > 0 {
+		w.announcements = append(w.announcements, msg)
+	}
+}
+
+// seedMessage returns a SeedMessage.
+func (w *World) seedMessage() []byte {
+	b, err := json.Marshal(SeedMessage{w.seed})
+	if err != nil {
+		log.Println(err)
+		return []byte{}
+	}
+	return b
+}
+
+// ruleMessage returns a RuleMessage, after the given event has changed the
+// rule.  The event can be nil.
+func (w *World) ruleMessage(a *AbstractEvent) []byte {
+	state := RuleState{Name: w.War.Rule()}
+	if a != nil {
+		if e, ok := w.Ents[a.SourceId]; ok {
+			state.By = e.Name
+		}
+	}
+	b, err := json.Marshal(RuleMessage{state})
+	if err != nil {
+		log.Println(err)
+		return []byte{}
+	}
+	return b
+}
+
+// snapshotLoadedMessage returns a SnapshotLoadedMessage, after the given
+// "LoadSnapshot" event.
+func (w *World) snapshotLoadedMessage(a *AbstractEvent) []byte {
+	state := SnapshotLoadedState{Name: a.EventBody, Tick: w.War.Tick()}
+	if e, ok := w.Ents[a.SourceId]; ok {
+		state.By = e.Name
+	}
+	b, err := json.Marshal(SnapshotLoadedMessage{state})
+	if err != nil {
+		log.Println(err)
+		return []byte{}
+	}
+	return b
+}
+
+// patternMessage returns a PatternMessage, for an "ExportPattern" event.
+func (w *World) patternMessage(a *AbstractEvent) ([]byte, error) {
+	x, y, width, height := a.Location.X, a.Location.Y, a.Width, a.Height
+	if width <= 0 || height <= 0 {
+		x, y, width, height = 0, 0, w.w, w.h
+	}
+	p := w.War.Region(x, y, width, height)
+	state := PatternState{Format: a.EventBody, Width: p.Width, Height: p.Height}
+	switch a.EventBody {
+	case "", "rle":
+		state.Format, state.Text = "rle", p.RLE()
+	case "cells":
+		state.Text = p.PlainText()
+	default:
+		return nil, fmt.Errorf("there is no pattern format called %q; "+
+			"try rle or cells", a.EventBody)
+	}
+	return json.Marshal(PatternMessage{state})
+}
+
+// findPattern returns the pattern with the given name, or reads the
+// pattern if it isn't a name.
+func findPattern(body string) (*pattern.Pattern, error) {
+	if p, ok := pattern.Lookup(strings.TrimSpace(body)); ok {
+		return p, nil
+	}
+	p, err := pattern.Parse(body)
+	if err != nil && !strings.ContainsAny(body, "\n$!") {
+		return nil, fmt.Errorf("there is no pattern called %q; try one of: "+
+			"%s, or a pattern in the .rle or .cells format",
+			body, strings.Join(pattern.Names(), ", "))
+	}
+	if err == nil && p.Count() == 0 {
+		return nil, fmt.Errorf("the pattern is empty")
+	}
+	return p, err
+}
+
+// playbackMessage returns a PlaybackMessage, after the given event has
+// changed the playback.  The event can be nil.
+func (w *World) playbackMessage(a *AbstractEvent) []byte {
+	state := PlaybackState{
+		Paused: w.War.Paused(),
+		Speed:  w.War.Speed(),
+		Tick:   w.War.Tick(),
+	}
+	if a != nil {
+		state.Event = a.EventType
+		if e, ok := w.Ents[a.SourceId]; ok {
+			state.By = e.Name
+		}
+	}
+	b, err := json.Marshal(PlaybackMessage{state})
+	if err != nil {
+		log.Println(err)
+		return []byte{}
+	}
+	return b
+}
+
 // ______________________________________________________
 // 		Message & Event Handler
 // ------------------------------------------------------
 
+// systemEvents can only be sent by the server itself, never by players.
+var systemEvents = map[string]bool{
+	"Login":      true,
+	"Logout":     true,
+	"Rename":     true,
+	"LifeDelta":  true,
+	"LifeFrame":  true,
+	"LifeUpdate": true,
+
+	"Announcements": true,
+}
+
+// adminEvents can only be sent by admins, or by the server itself.  The
+// playback and the rule are shared by the whole room, so players can't
+// change them either.
+var adminEvents = map[string]bool{
+	"Pause":        true,
+	"Resume":       true,
+	"Step":         true,
+	"SetSpeed":     true,
+	"SetRule":      true,
+	"SaveSnapshot": true,
+	"LoadSnapshot": true,
+}
+
 // DoGameEvent actually executes the functions to the game world.
 // Passing AbstractEvent messages to DoGameEvent will check what kind of
 // event it is, and if it has the required parameters, and then attempt to
@@ -131,7 +512,16 @@ func (w *World) stateAllEntities() []byte {
 // calling DoGameEvent.  If there is a channel included in the AbstractEvent,
 // then it can be utilized by this event handler.
 //
+// The result is true or false for events that have simply worked or not,
+// and an *EventError for events that were rejected, with the reason why.
+//
 func (w *World) DoGameEvent(a *AbstractEvent) interface{} {
+	if a.SourceType == "Player" && systemEvents[a.EventType] {
+		return a.NewError(ErrNotAllowed, "Players can't send that event.")
+	}
+	if a.SourceType == "Player" && adminEvents[a.EventType] {
+		return a.NewError(ErrNotAllowed, "Only admins can send that event.")
+	}
 	switch a.EventType {
 
 	case "LifeState":
@@ -141,8 +531,136 @@ func (w *World) DoGameEvent(a *AbstractEvent) interface{} {
 			return true
 		}
 
+	// LifeDelta responds with the changes since the last LifeDelta, as a
+	// *gameofwar.GridUpdate.  Every so often, it is a full state instead.
+	case "LifeDelta":
+		if a.Response != nil {
+			a.Response <- w.War.LifeChanges()
+			return true
+		}
+
+	// LifeFrame responds with the full state, as a *gameofwar.GridUpdate.
+	case "LifeFrame":
+		if a.Response != nil {
+			a.Response <- w.War.LifeState()
+			return true
+		}
+
 	case "LifeUpdate":
 		w.War.LifeUpdate()
+		w.checkGameOver()
+		w.updateScore()
+		return true
+
+	// Announcements responds with the messages that should be broadcast to
+	// everyone in the room, as a [][]byte, and forgets about them.
+	case "Announcements":
+		if a.Response != nil {
+			a.Response <- w.announcements
+			w.announcements = nil
+			return true
+		}
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	//      Playback Controls: everyone is told about them.
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+	case "Playback":
+		if a.Response != nil {
+			a.Response <- w.playbackMessage(nil)
+			return true
+		}
+
+	case "Pause":
+		if !w.War.Pause() {
+			return a.NewError(ErrFailed, "The game is already paused.")
+		}
+		w.announce(w.playbackMessage(a))
+		return true
+
+	case "Resume":
+		if !w.War.Resume() {
+			return a.NewError(ErrFailed, "The game isn't paused.")
+		}
+		w.announce(w.playbackMessage(a))
+		return true
+
+	// Step moves a paused game forward by "Integer" generations (or 1).
+	case "Step":
+		n := a.Integer
+		if n == 0 {
+			n = 1
+		}
+		if n < 0 || n > MAX_STEPS_PER_EVENT {
+			return a.NewError(ErrOutOfRange, fmt.Sprintf(
+				"You can step between 1 and %d generations at a time.",
+				MAX_STEPS_PER_EVENT))
+		}
+		if !w.War.Step(n) {
+			return a.NewError(ErrFailed, "The game has to be paused first.")
+		}
+		w.announce(w.playbackMessage(a))
+		w.checkGameOver()
+		w.updateScore()
+		return true
+
+	// SetSpeed sets the number of generations per tick to "Integer".
+	case "SetSpeed":
+		if !w.War.SetSpeed(a.Integer) {
+			return a.NewError(ErrOutOfRange, fmt.Sprintf(
+				"The speed has to be between %d and %d.",
+				gameofwar.MIN_GAME_SPEED, gameofwar.MAX_GAME_SPEED))
+		}
+		w.announce(w.playbackMessage(a))
+		return true
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	//      Cellular Automaton Rules
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+	case "Seed":
+		if a.Response != nil {
+			a.Response <- w.seedMessage()
+			return true
+		}
+
+	case "Rule":
+		if a.Response != nil {
+			a.Response <- w.ruleMessage(nil)
+			return true
+		}
+
+	case "SetRule":
+		if err := w.War.SetRule(a.EventBody); err != nil {
+			return a.NewError(ErrUnknownRule, err.Error())
+		}
+		w.announce(w.ruleMessage(a))
+		return true
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	//      Named Snapshots: only for admins.
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+	// SaveSnapshot saves the world under the name in "EventBody".
+	case "SaveSnapshot":
+		if err := w.saveNamed(a.EventBody); err != nil {
+			return a.NewError(ErrFailed, err.Error())
+		}
+		return true
+
+	// LoadSnapshot replaces the world with the snapshot that was saved
+	// under the name in "EventBody".  Everyone is told about everything
+	// that might have changed.
+	case "LoadSnapshot":
+		if err := w.loadNamed(a.EventBody); err != nil {
+			return a.NewError(ErrFailed, err.Error())
+		}
+		w.announce(w.snapshotLoadedMessage(a))
+		w.announce(w.seedMessage())
+		w.announce(w.playbackMessage(nil))
+		w.announce(w.ruleMessage(nil))
+		w.announce(w.roundMessage())
+		w.announce(w.scoreMessage())
 		return true
 
 	case "LifeRandomize":
@@ -151,20 +669,122 @@ func (w *World) DoGameEvent(a *AbstractEvent) interface{} {
 			numberToMake = a.Integer
 		}
 		w.War.RandomizeGameBoard(numberToMake)
+		return true
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	//      Rounds: Lobby -> Running -> Finished
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 
+	case "Round":
+		if a.Response != nil {
+			a.Response <- w.roundMessage()
+			return true
+		}
+
+	case "Score":
+		if a.Response != nil {
+			a.Response <- w.scoreMessage()
+			return true
+		}
+
+	case "StartGame":
+		if w.War.Round().Phase != gameofwar.PHASE_LOBBY {
+			return a.NewError(ErrFailed, "The round has already started.  "+
+				"Start a FreshGame to go back to the lobby.")
+		}
+		s := w.War.Territory()
+		if (s.Team1 == 0 || s.Team2 == 0) && w.War.VictoryConditions().Elimination {
+			return a.NewError(ErrFailed,
+				"Both teams need some territory before the round can start.")
+		}
+		w.War.StartRound()
+		w.announce(w.roundMessage())
+		return true
+
+	// FreshGame makes a new board, and goes back to the lobby.
 	case "FreshGame":
 		w.War.FreshGameBoard()
+		w.War.ResetRound()
+		w.announce(w.roundMessage())
+		return true
 
 	case "LifeChange":
 		//
 		// !NOTE! The naming of this Location is confusing.
 		// It is actually a "GridLocation" type in messages.go
 		//
+		if err := w.checkPlayerValue(a, &a.Value); err != nil {
+			return err
+		}
 		w.War.ChangeAt(a.Location.X, a.Location.Y, a.Value)
 		return true
 
 	case "LaBomba":
-		return w.War.DropBomb(a.Location.X, a.Location.Y)
+		if err := w.checkPlayerValue(a, &a.Value); err != nil {
+			return err
+		}
+		switch w.War.DropBomb(a.Value, a.Location.X, a.Location.Y) {
+		case nil:
+			return true
+		case gameofwar.ErrBombCooldown:
+			return a.NewError(ErrCooldown, gameofwar.ErrBombCooldown.Error())
+		case gameofwar.ErrNotEnoughResources:
+			return a.NewError(ErrNoResources,
+				gameofwar.ErrNotEnoughResources.Error())
+		}
+		return false
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	//      Patterns: .rle and .cells
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+	// PlacePattern stamps a pattern onto the grid, with its top left corner
+	// at "Location".  "EventBody" is the name of a pattern, or a pattern in
+	// the .rle or .cells format, and "Integer" is its orientation (0 to 7).
+	// Every living cell of the pattern becomes "Value".  Teams pay for
+	// their patterns like they do for bombs.
+	case "PlacePattern":
+		if err := w.checkPlayerValue(a, &a.Value); err != nil {
+			return err
+		}
+		p, err := findPattern(a.EventBody)
+		if err != nil {
+			return a.NewError(ErrBadPattern, err.Error())
+		}
+		p, err = p.Orient(a.Integer)
+		if err != nil {
+			return a.NewError(ErrOutOfRange, err.Error())
+		}
+		if a.SourceType == "Player" && p.Count() > MAX_PATTERN_CELLS {
+			return a.NewError(ErrOutOfRange, fmt.Sprintf(
+				"Patterns can have up to %d living cells.", MAX_PATTERN_CELLS))
+		}
+		switch w.War.PlacePattern(p, a.Location.X, a.Location.Y, a.Value) {
+		case nil:
+			return true
+		case gameofwar.ErrRoundNotRunning:
+			return a.NewError(ErrFailed, gameofwar.ErrRoundNotRunning.Error())
+		case gameofwar.ErrBombCooldown:
+			return a.NewError(ErrCooldown, gameofwar.ErrBombCooldown.Error())
+		case gameofwar.ErrPatternTooDear:
+			return a.NewError(ErrNoResources,
+				gameofwar.ErrPatternTooDear.Error())
+		}
+		return false
+
+	// ExportPattern responds with the part of the grid that starts at
+	// "Location", and has the size "Width" x "Height", as a PatternMessage.
+	// Without a size, it is the whole grid.  "EventBody" is the format:
+	// "rle" (the default) or "cells".
+	case "ExportPattern":
+		if a.Response != nil {
+			msg, err := w.patternMessage(a)
+			if err != nil {
+				return a.NewError(ErrBadPattern, err.Error())
+			}
+			a.Response <- msg
+			return true
+		}
 
 	case "GameState":
 		if a.Response != nil {
@@ -175,18 +795,42 @@ func (w *World) DoGameEvent(a *AbstractEvent) interface{} {
 	case "Move":
 		return w.changeEntityLocation(a.SourceId, a.Location.X, a.Location.Y)
 
+	// Login happens even if nobody is waiting for the response, so that
+	// the players come back when a journal is replayed.
 	case "Login":
+		name := a.EventBody
+		if name == "" {
+			name = namegen.GenerateUsernameFrom(w.rng)
+		}
+		id, _ := w.generatePlayer(name)
+		login := PlayerLogin{PlayerId: id, Username: name}
+		if e, ok := w.Ents[id]; ok {
+			login.Team = e.Team
+		}
 		if a.Response != nil {
-			id, _ := w.generatePlayer(a.EventBody)
-			a.Response <- id
-			return true
+			a.Response <- login
 		}
+		return true
 
 	case "Logout":
 		return w.deleteEntity(a.TargetId)
 
+	case "Rename":
+		if e, ok := w.Ents[a.TargetId]; ok {
+			e.Name = a.EventBody
+			return true
+		}
+
 	case "ChangeMany":
 		log.Println("Bulk Event: ChangeMany: Length:", len(a.Changes))
+
+		// Every change is checked before any of them are made, so that
+		// the bulk event is either done completely, or not at all.
+		for i := range a.Changes {
+			if err := w.checkPlayerValue(a, &a.Changes[i].Value); err != nil {
+				return err
+			}
+		}
 		for i := range a.Changes {
 			w.War.ChangeAt(a.Changes[i].Location.X, a.Changes[i].Location.Y, a.Changes[i].Value)
 		}
@@ -195,6 +839,9 @@ func (w *World) DoGameEvent(a *AbstractEvent) interface{} {
 	case "Create":
 	case "Delete":
 
+	default:
+		return a.NewError(ErrUnknownEvent, "There is no event called \""+
+			a.EventType+"\".")
 	}
 	return false
 }
@@ -210,12 +857,36 @@ func (w *World) DoGameEvent(a *AbstractEvent) interface{} {
 type GamePram struct {
 	w         *World
 	eventchan chan *AbstractEvent
+	quit      chan struct{}
+	stopped   chan struct{}
+
+	// journal records the events that change the world.  It can be nil.
+	journal Journal
+}
+
+// NewGamePram runs a new world, with the given settings.
+func NewGamePram(s Settings) *GamePram {
+	return NewGamePramWithWorld(MakeNewWorld(s))
 }
 
-func NewGamePram() *GamePram {
+// NewGamePramWithWorld runs an existing world in a new Game PRAM.
+func NewGamePramWithWorld(w *World) *GamePram {
+	return NewGamePramWithJournal(w, nil)
+}
+
+// NewGamePramWithJournal runs an existing world in a new Game PRAM, and
+// records its events in the journal, starting with a snapshot of the world.
+// The Game PRAM closes the journal when it stops.
+func NewGamePramWithJournal(w *World, j Journal) *GamePram {
 	storedpram := &GamePram{
-		w:         MakeNewWorld(),
+		w:         w,
 		eventchan: make(chan *AbstractEvent),
+		quit:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+		journal:   j,
+	}
+	if j != nil {
+		storedpram.recordStart()
 	}
 	log.Println("The World is now running in the Game PRAM...")
 	go storedpram.run()
@@ -223,14 +894,102 @@ func NewGamePram() *GamePram {
 }
 
 func (g *GamePram) run() {
+	defer close(g.stopped)
+	if g.journal != nil {
+		defer g.journal.Close()
+	}
+	for {
+		select {
+		case event := <-g.eventchan:
+			g.handle(event)
+		case <-g.quit:
+			g.drain()
+			return
+		}
+	}
+}
+
+func (g *GamePram) handle(event *AbstractEvent) {
+	journaled := g.journal != nil && !readOnlyEvents[event.EventType]
+	if journaled && event.EventType != "LoadSnapshot" {
+		g.record(newJournalEntry(g.w.War.Tick(), event))
+	}
+	result := g.w.DoGameEvent(event)
+
+	// A loaded snapshot starts a new session in the journal, instead of
+	// being an event, so that replays don't depend on the snapshot file.
+	if journaled && event.EventType == "LoadSnapshot" && result == true {
+		g.recordStart()
+	}
+	g.reply(event, result)
+}
+
+// recordStart starts a new session in the journal, from the world as it
+// is now.
+func (g *GamePram) recordStart() {
+	g.record(JournalEntry{
+		Tick:  g.w.War.Tick(),
+		Start: &JournalStart{Settings: g.w.settings, World: g.w.Snapshot()},
+	})
+}
+
+// record adds an entry to the journal.  The game goes on if it can't be
+// written, since the journal is only there to look back at.
+func (g *GamePram) record(e JournalEntry) {
+	if err := g.journal.Record(e); err != nil {
+		log.Println("Journal:", err)
+	}
+}
+
+// drain handles the events that are already waiting to be received.
+func (g *GamePram) drain() {
 	for {
 		select {
 		case event := <-g.eventchan:
-			g.w.DoGameEvent(event)
+			g.handle(event)
+		default:
+			return
 		}
 	}
 }
 
+// reply sends an Ack or Error back to the player (or admin) who sent the
+// event.  Events from the system itself don't get replies, since their
+// callers are only waiting for the response that they asked for.
+func (g *GamePram) reply(event *AbstractEvent, result interface{}) {
+	if event.SourceType != "Player" && event.SourceType != "Admin" ||
+		event.Response == nil {
+		return
+	}
+	event.Response <- event.ReplyMessage(result)
+}
+
+// send passes the event to the event loop.  It returns false if the loop
+// has already ended, in which case nobody is listening, and the event is
+// dropped.
+func (g *GamePram) send(event *AbstractEvent) bool {
+	select {
+	case g.eventchan <- event:
+		return true
+	case <-g.stopped:
+		return false
+	}
+}
+
+// Stop ends the event loop of the Game PRAM, after handling the events that
+// are already waiting.  It returns once the loop has ended.  Events that are
+// sent after that are dropped, and the requests return nothing.
+func (g *GamePram) Stop() {
+	close(g.quit)
+	<-g.stopped
+}
+
+// Shutdown stops the Game PRAM, and returns a snapshot of its world.
+func (g *GamePram) Shutdown() *WorldSnapshot {
+	g.Stop()
+	return g.w.Snapshot()
+}
+
 // RequestSomething helps send game event messages that requires a response.
 // It creates a response channel, sends the message, and awaits response.
 // The function returns the value as a byte stream.
@@ -240,7 +999,9 @@ func (g *GamePram) RequestSomething(eventType string) []byte {
 		EventType: eventType,
 		Response:  r,
 	}
-	g.eventchan <- event
+	if !g.send(event) {
+		return []byte{}
+	}
 	a := <-r
 	output, ok := a.([]byte)
 	if ok {
@@ -249,21 +1010,44 @@ func (g *GamePram) RequestSomething(eventType string) []byte {
 	return []byte{}
 }
 
-// LoginEvent returns playerId; If playerId returns 0, Login failed!
-func (g *GamePram) LoginEvent(username string) int {
+// RequestGrid is like RequestSomething, but for the events that respond
+// with a grid update that hasn't been encoded yet: "LifeDelta" and
+// "LifeFrame".  It returns nil if something unexpected happens.
+func (g *GamePram) RequestGrid(eventType string) *gameofwar.GridUpdate {
+	r := make(chan interface{})
+	event := &AbstractEvent{
+		EventType: eventType,
+		Response:  r,
+	}
+	if !g.send(event) {
+		return nil
+	}
+	a := <-r
+	output, ok := a.(*gameofwar.GridUpdate)
+	if ok {
+		return output
+	}
+	return nil
+}
+
+// LoginEvent returns playerId, team and username; If playerId returns 0,
+// Login failed!  If the username is empty, then the world makes one up.
+func (g *GamePram) LoginEvent(username string) (int, uint8, string) {
 	r := make(chan interface{})
 	event := &AbstractEvent{
 		EventType: "Login",
 		EventBody: username,
 		Response:  r,
 	}
-	g.eventchan <- event  // Send Event
-	a := <-r              // Wait for response
-	output, ok := a.(int) // Converts the empty interface into Integer
+	if !g.send(event) { // Send Event
+		return 0, 0, ""
+	}
+	a := <-r                      // Wait for response
+	output, ok := a.(PlayerLogin) // Converts the empty interface
 	if ok {
-		return output
+		return output.PlayerId, output.Team, output.Username
 	}
-	return 0 // If something unexpected happens, return 0.
+	return 0, 0, "" // If something unexpected happens, return 0.
 }
 
 func (g *GamePram) LogoutEvent(playerId int) {
@@ -271,16 +1055,44 @@ func (g *GamePram) LogoutEvent(playerId int) {
 		EventType: "Logout",
 		TargetId:  playerId,
 	}
-	g.eventchan <- event
+	g.send(event)
+}
+
+// RenameEvent changes the name of a player's entity.
+func (g *GamePram) RenameEvent(playerId int, name string) {
+	event := &AbstractEvent{
+		EventType: "Rename",
+		TargetId:  playerId,
+		EventBody: name,
+	}
+	g.send(event)
+}
+
+// RequestAnnouncements returns the messages that the game wants to be
+// broadcast to everyone in the room, since the last time it was called.
+func (g *GamePram) RequestAnnouncements() [][]byte {
+	r := make(chan interface{})
+	event := &AbstractEvent{
+		EventType: "Announcements",
+		Response:  r,
+	}
+	if !g.send(event) {
+		return nil
+	}
+	a := <-r
+	output, _ := a.([][]byte)
+	return output
 }
 
 func (g *GamePram) UpdateLifeEvent() {
 	event := &AbstractEvent{
 		EventType: "LifeUpdate",
 	}
-	g.eventchan <- event
+	g.send(event)
 }
 
+// CustomPlayerEvent passes an event from a player to the game.  The reply
+// is sent on the event's Response channel, unless the game has stopped.
 func (g *GamePram) CustomPlayerEvent(event *AbstractEvent) {
-	g.eventchan <- event
+	g.send(event)
 }
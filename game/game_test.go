@@ -0,0 +1,272 @@
+package game
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fractalbach/fractalnet/cellular/gameofwar"
+)
+
+// newTestWorld returns a small world with a running round, so that the
+// generations and the economy move forward.
+func newTestWorld(t *testing.T) *World {
+	w := MakeNewWorld(Settings{
+		Width: 32, Height: 32, Seed: 1,
+		Economy: gameofwar.Economy{
+			StartResources: 10, MaxResources: 1000,
+			Income: 1, BombCost: 5, BombCooldown: 50,
+		},
+	})
+	w.War.RandomizeGameBoard(20)
+	w.War.StartRound()
+	return w
+}
+
+func TestPlayersAreSpreadBetweenTeams(t *testing.T) {
+	w := MakeNewWorld(Settings{Width: 48, Height: 48})
+	want := []uint8{
+		gameofwar.TEAM_1, gameofwar.TEAM_2,
+		gameofwar.TEAM_1, gameofwar.TEAM_2,
+		gameofwar.TEAM_1,
+	}
+	ids := []int{}
+	for i, team := range want {
+		id, ok := w.generatePlayer("player")
+		if !ok {
+			t.Fatalf("player %d couldn't be created", i)
+		}
+		if got := w.Ents[id].Team; got != team {
+			t.Errorf("player %d is on team %d, want %d", i, got, team)
+		}
+		ids = append(ids, id)
+	}
+
+	// When a team 2 player leaves, the next player goes to team 2.
+	w.deleteEntity(ids[1])
+	id, _ := w.generatePlayer("player")
+	if got := w.Ents[id].Team; got != gameofwar.TEAM_2 {
+		t.Errorf("the next player is on team %d, want %d",
+			got, gameofwar.TEAM_2)
+	}
+}
+
+func TestCheckPlayerValue(t *testing.T) {
+	w := MakeNewWorld(Settings{Width: 48, Height: 48})
+	one, _ := w.generatePlayer("one") // team 1
+	two, _ := w.generatePlayer("two") // team 2
+
+	tests := []struct {
+		sourceType string
+		sourceId   int
+		value      uint8
+		want       uint8  // the value after the check
+		code       string // the error code, or "" if it's allowed
+	}{
+		{"Player", one, 0, gameofwar.TEAM_1, ""},
+		{"Player", two, 0, gameofwar.TEAM_2, ""},
+		{"Player", one, gameofwar.TEAM_1, gameofwar.TEAM_1, ""},
+		{"Player", one, gameofwar.TEAM_2, gameofwar.TEAM_2, ErrWrongTeam},
+		{"Player", two, gameofwar.TEAM_1, gameofwar.TEAM_1, ErrWrongTeam},
+		{"Player", one, 10, 10, ErrIllegalValue},
+		{"Player", 99, 0, 0, ErrNotOnTeam},
+
+		// The server isn't a player, so it can place anything.
+		{"", 0, 10, 10, ""},
+		{"", 0, 0, 0, ""},
+	}
+	for _, test := range tests {
+		a := &AbstractEvent{
+			SourceType: test.sourceType, SourceId: test.sourceId,
+		}
+		v := test.value
+		code := ""
+		if err := w.checkPlayerValue(a, &v); err != nil {
+			code = err.Code
+		}
+		if code != test.code || v != test.want {
+			t.Errorf("%s %d placing %d: got %d, %q, want %d, %q",
+				test.sourceType, test.sourceId, test.value,
+				v, code, test.want, test.code)
+		}
+	}
+}
+
+func TestChangeManyIsCheckedFirst(t *testing.T) {
+	w := MakeNewWorld(Settings{Width: 48, Height: 48})
+	id, _ := w.generatePlayer("one") // team 1
+
+	r := w.DoGameEvent(&AbstractEvent{
+		EventType: "ChangeMany", SourceType: "Player", SourceId: id,
+		Changes: []SingleChange{
+			{Value: gameofwar.TEAM_1, Location: Location{X: 1, Y: 1}},
+			{Value: gameofwar.TEAM_2, Location: Location{X: 2, Y: 2}},
+		},
+	})
+	if err, ok := r.(*EventError); !ok || err.Code != ErrWrongTeam {
+		t.Fatalf("a ChangeMany with the other team's value returned %#v", r)
+	}
+}
+
+func TestPlayerCantSendLifeUpdate(t *testing.T) {
+	w := newTestWorld(t)
+	tick := w.War.Tick()
+
+	r := w.DoGameEvent(&AbstractEvent{
+		EventType: "LifeUpdate", SourceType: "Player", SourceId: 1,
+	})
+	err, ok := r.(*EventError)
+	if !ok || err.Code != ErrNotAllowed {
+		t.Fatalf("a LifeUpdate from a player returned %#v, want %s",
+			r, ErrNotAllowed)
+	}
+	if w.War.Tick() != tick {
+		t.Errorf("a player's LifeUpdate moved the game from tick %d to %d",
+			tick, w.War.Tick())
+	}
+
+	// The server can still send it.
+	if r := w.DoGameEvent(&AbstractEvent{EventType: "LifeUpdate"}); r != true {
+		t.Fatalf("a LifeUpdate from the server returned %#v", r)
+	}
+	if w.War.Tick() == tick {
+		t.Errorf("a LifeUpdate from the server didn't move the game")
+	}
+}
+
+func TestPlayerCantSpeedUpEconomy(t *testing.T) {
+	w := newTestWorld(t)
+	w.War.LoadBudgets(gameofwar.Budgets{
+		Team1: gameofwar.TeamBudget{Resources: 10, Cooldown: 50},
+		Team2: gameofwar.TeamBudget{Resources: 10, Cooldown: 50},
+	})
+	before := w.War.Budgets()
+
+	// A player sending LifeUpdate over and over, hoping to earn resources
+	// and cool their bombs down faster than the server's ticks.
+	for i := 0; i < 100; i++ {
+		w.DoGameEvent(&AbstractEvent{
+			EventType: "LifeUpdate", SourceType: "Player", SourceId: 1,
+		})
+	}
+	if after := w.War.Budgets(); after != before {
+		t.Fatalf("a player's LifeUpdates changed the budgets from %+v to %+v",
+			before, after)
+	}
+
+	// One tick of the server pays the income, and counts the cooldowns
+	// down.
+	w.DoGameEvent(&AbstractEvent{EventType: "LifeUpdate"})
+	after := w.War.Budgets()
+	if after.Team1.Resources <= before.Team1.Resources {
+		t.Errorf("team 1 didn't earn anything in a tick: %+v", after.Team1)
+	}
+	if after.Team1.Cooldown != before.Team1.Cooldown-1 {
+		t.Errorf("team 1's cooldown went from %d to %d in a tick, want %d",
+			before.Team1.Cooldown, after.Team1.Cooldown,
+			before.Team1.Cooldown-1)
+	}
+}
+
+func TestPlaybackIsForAdmins(t *testing.T) {
+	tests := []AbstractEvent{
+		{EventType: "Pause"},
+		{EventType: "Step", Integer: 2},
+		{EventType: "SetSpeed", Integer: 4},
+		{EventType: "SetRule", EventBody: "B36/S23"},
+		{EventType: "Resume"},
+	}
+	w := newTestWorld(t)
+	for _, test := range tests {
+		for _, source := range []string{"Player", "Admin"} {
+			a := test
+			a.SourceType, a.SourceId = source, 1
+			r := w.DoGameEvent(&a)
+			err, isErr := r.(*EventError)
+			switch {
+			case source == "Player" && (!isErr || err.Code != ErrNotAllowed):
+				t.Errorf("%s from a player returned %#v, want %s",
+					a.EventType, r, ErrNotAllowed)
+			case source == "Admin" && r != true:
+				t.Errorf("%s from an admin returned %#v", a.EventType, r)
+			}
+		}
+	}
+}
+
+func TestStepUpdatesTheScore(t *testing.T) {
+	w := newTestWorld(t)
+	w.updateScore()
+	w.War.Pause()
+	w.announcements = nil
+
+	w.DoGameEvent(&AbstractEvent{EventType: "Step", Integer: 5})
+	found := false
+	for _, msg := range w.announcements {
+		found = found || strings.HasPrefix(string(msg), `{"Score":`)
+	}
+	if !found {
+		t.Errorf("a Step didn't announce the score: %q", w.announcements)
+	}
+}
+
+func TestPatternsArePaidFor(t *testing.T) {
+	w := newTestWorld(t)
+	e := w.War.Economy()
+	e.CellCost = 2
+	w.War.SetEconomy(e)
+	one, _ := w.generatePlayer("one") // team 1
+	glider := func(source string, x int) interface{} {
+		return w.DoGameEvent(&AbstractEvent{
+			EventType: "PlacePattern", EventBody: "glider",
+			SourceType: source, SourceId: one,
+			Location: Location{X: x, Y: 2},
+		})
+	}
+	code := func(r interface{}) string {
+		if err, ok := r.(*EventError); ok {
+			return err.Code
+		}
+		return ""
+	}
+
+	// A glider has 5 living cells, so it costs 10.
+	w.War.LoadBudgets(gameofwar.Budgets{
+		Team1: gameofwar.TeamBudget{Resources: 15},
+	})
+	if r := glider("Player", 2); r != true {
+		t.Fatalf("an affordable glider returned %#v", r)
+	}
+	b := w.War.Budgets().Team1
+	if b.Resources != 5 || b.Cooldown != e.BombCooldown {
+		t.Errorf("after a glider, team 1 has %+v, want 5 resources and "+
+			"a cooldown of %d", b, e.BombCooldown)
+	}
+	if c := code(glider("Player", 10)); c != ErrCooldown {
+		t.Errorf("a glider during the cooldown got %q, want %q",
+			c, ErrCooldown)
+	}
+	w.War.LoadBudgets(gameofwar.Budgets{
+		Team1: gameofwar.TeamBudget{Resources: 9},
+	})
+	if c := code(glider("Player", 10)); c != ErrNoResources {
+		t.Errorf("a glider that costs too much got %q, want %q",
+			c, ErrNoResources)
+	}
+
+	// Outside of a running round, players can't place patterns at all, but
+	// the server still can.
+	w.War.LoadRound(gameofwar.RoundState{Phase: gameofwar.PHASE_LOBBY})
+	w.War.LoadBudgets(gameofwar.Budgets{
+		Team1: gameofwar.TeamBudget{Resources: 100},
+	})
+	if c := code(glider("Player", 10)); c != ErrFailed {
+		t.Errorf("a glider in the lobby got %q, want %q", c, ErrFailed)
+	}
+	if r := glider("", 10); r != true {
+		t.Errorf("a glider from the server returned %#v", r)
+	}
+	if b := w.War.Budgets().Team1; b.Resources != 100 {
+		t.Errorf("patterns in the lobby cost team 1 %d resources",
+			100-b.Resources)
+	}
+}
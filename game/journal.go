@@ -0,0 +1,291 @@
+package game
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// ===========================================================================
+//      Event Journal & Replay
+// ___________________________________________________________________________
+
+/*
+The journal remembers every event that changed a world, in the order that
+the Game PRAM handled them, along with the tick that the world was on.
+Events that only ask a question (like "Score" or "LifeDelta") are left out,
+since they can't change anything.
+
+A journal starts with a snapshot of the world, so that it can be replayed
+from there.  Each time a world starts running in a Game PRAM, or an admin
+loads a snapshot into it, a new start entry is written, so a single journal
+file can hold many sessions of the same room:
+
+        {"Tick":120,"Start":{"Settings":{...},"World":{...}}}
+        {"Tick":120,"EventType":"LifeUpdate"}
+        {"Tick":121,"EventType":"LaBomba","SourceId":3,"SourceType":"Player",...}
+        {"Tick":121,"EventType":"LifeUpdate"}
+
+Since everything random in a world comes from its seed, playing the same
+events on the same snapshot always gives the same board.
+*/
+
+// readOnlyEvents don't change the world, so they aren't journaled.
+var readOnlyEvents = map[string]bool{
+	"SaveSnapshot":  true,
+	"LifeState":     true,
+	"LifeDelta":     true,
+	"LifeFrame":     true,
+	"Announcements": true,
+	"Playback":      true,
+	"Seed":          true,
+	"Rule":          true,
+	"Round":         true,
+	"Score":         true,
+	"GameState":     true,
+	"ExportPattern": true,
+}
+
+// JournalEntry is a single line of the journal: either an event, or the
+// start of a session.
+type JournalEntry struct {
+
+	// Tick is the tick that the world was on, before the event happened.
+	Tick int
+
+	// These are the fields of the AbstractEvent.
+	EventType  string         `json:",omitempty"`
+	EventId    int            `json:",omitempty"`
+	SourceId   int            `json:",omitempty"`
+	SourceType string         `json:",omitempty"`
+	TargetId   int            `json:",omitempty"`
+	Integer    int            `json:",omitempty"`
+	Value      uint8          `json:",omitempty"`
+	Location   *Location      `json:",omitempty"`
+	Width      int            `json:",omitempty"`
+	Height     int            `json:",omitempty"`
+	EventBody  string         `json:",omitempty"`
+	Changes    []SingleChange `json:",omitempty"`
+
+	// Start is only in the first entry of a session.
+	Start *JournalStart `json:",omitempty"`
+}
+
+// JournalStart is everything needed to rebuild the world at the start of
+// a session.
+type JournalStart struct {
+	Settings Settings
+	World    *WorldSnapshot
+}
+
+// newJournalEntry copies an event into a journal entry.
+func newJournalEntry(tick int, a *AbstractEvent) JournalEntry {
+	e := JournalEntry{
+		Tick:       tick,
+		EventType:  a.EventType,
+		EventId:    a.EventId,
+		SourceId:   a.SourceId,
+		SourceType: a.SourceType,
+		TargetId:   a.TargetId,
+		Integer:    a.Integer,
+		Value:      a.Value,
+		Width:      a.Width,
+		Height:     a.Height,
+		EventBody:  a.EventBody,
+	}
+	if a.Location != (Location{}) {
+		loc := a.Location
+		e.Location = &loc
+	}
+	if len(a.Changes) > 0 {
+		e.Changes = make([]SingleChange, len(a.Changes))
+		copy(e.Changes, a.Changes)
+	}
+	return e
+}
+
+// Event turns the entry back into an event, without a Response channel.
+func (e *JournalEntry) Event() *AbstractEvent {
+	a := &AbstractEvent{
+		EventType:  e.EventType,
+		EventId:    e.EventId,
+		SourceId:   e.SourceId,
+		SourceType: e.SourceType,
+		TargetId:   e.TargetId,
+		Integer:    e.Integer,
+		Value:      e.Value,
+		Width:      e.Width,
+		Height:     e.Height,
+		EventBody:  e.EventBody,
+	}
+	if e.Location != nil {
+		a.Location = *e.Location
+	}
+	if len(e.Changes) > 0 {
+		a.Changes = make([]SingleChange, len(e.Changes))
+		copy(a.Changes, e.Changes)
+	}
+	return a
+}
+
+// Journal is an append-only record of the events of a world.  It is safe to
+// use from multiple goroutines.
+type Journal interface {
+
+	// Record adds an entry to the end of the journal.
+	Record(e JournalEntry) error
+
+	// Entries returns every entry in the journal, oldest first.
+	Entries() ([]JournalEntry, error)
+
+	// Close releases the journal.  It can't be used after that.
+	Close() error
+}
+
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+//      Memory Journal
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+// NewMemoryJournal returns a journal that is only kept in memory.
+func NewMemoryJournal() Journal {
+	return &memoryJournal{}
+}
+
+type memoryJournal struct {
+	mu      sync.Mutex
+	entries []JournalEntry
+}
+
+func (m *memoryJournal) Record(e JournalEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append(m.entries, e)
+	return nil
+}
+
+func (m *memoryJournal) Entries() ([]JournalEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := make([]JournalEntry, len(m.entries))
+	copy(entries, m.entries)
+	return entries, nil
+}
+
+func (m *memoryJournal) Close() error {
+	return nil
+}
+
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+//      File Journal
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+// OpenJournal opens (or creates) a journal file, with one json JournalEntry
+// per line.  New entries are added to the end of the file.
+func OpenJournal(path string) (Journal, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileJournal{path: path, f: f}, nil
+}
+
+type fileJournal struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+func (j *fileJournal) Record(e JournalEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, err = j.f.Write(append(b, '\n'))
+	return err
+}
+
+func (j *fileJournal) Entries() ([]JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return ReadJournal(j.path)
+}
+
+func (j *fileJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.f.Close()
+}
+
+// ReadJournal reads every entry of a journal file.  If the last line was
+// only partly written, then it is ignored.
+func ReadJournal(path string) ([]JournalEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []JournalEntry
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var e JournalEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		entries = append(entries, e)
+	}
+}
+
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+//      Replay
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+// Replay rebuilds the world as it was at the given tick, after every event
+// that happened on that tick.  It starts from the last session that had
+// begun by then, so the journal needs to go back that far.  If the session
+// ends before the tick, then the world is as it was at the end.
+//
+// Loading a snapshot can take a world back to an earlier tick.  If the
+// journal went through the same tick more than once, the last time wins.
+//
+// The replayed world is only meant to be looked at: its random numbers are
+// the same as the original's were, but nothing is listening to it.
+func Replay(entries []JournalEntry, tick int) (*World, error) {
+	start := -1
+	for i, e := range entries {
+		if e.Start != nil && e.Tick <= tick {
+			start = i
+		}
+	}
+	if start < 0 {
+		return nil, fmt.Errorf("the journal doesn't go back to tick %d", tick)
+	}
+	s := entries[start].Start
+	w, err := RestoreWorld(s.World, s.Settings)
+	if err != nil {
+		return nil, err
+	}
+
+	// A tick can end in the middle of a "LifeUpdate" or a "Step", so the
+	// game is told not to go past it.
+	w.War.StopAt(tick)
+	defer w.War.StopAt(-1)
+	for _, e := range entries[start+1:] {
+		if e.Tick > tick || e.Start != nil {
+			break
+		}
+		w.DoGameEvent(e.Event())
+	}
+	return w, nil
+}
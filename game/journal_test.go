@@ -0,0 +1,184 @@
+package game
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fractalbach/fractalnet/cellular/gameofwar"
+)
+
+// worldState is what the replay tests compare between two worlds.
+type worldState struct {
+	tick    int
+	cells   []byte
+	ents    map[int]Ent
+	budgets gameofwar.Budgets
+	rule    string
+}
+
+func stateOf(w *World) worldState {
+	s := worldState{
+		tick:    w.War.Tick(),
+		cells:   w.War.Cells(),
+		ents:    map[int]Ent{},
+		budgets: w.War.Budgets(),
+		rule:    w.War.Rule(),
+	}
+	for id, e := range w.Ents {
+		s.ents[id] = *e
+	}
+	return s
+}
+
+func compareStates(t *testing.T, what string, got, want worldState) {
+	if got.tick != want.tick {
+		t.Errorf("%s: the world is at tick %d, want %d",
+			what, got.tick, want.tick)
+	}
+	if !bytes.Equal(got.cells, want.cells) {
+		t.Errorf("%s: the cells are different", what)
+	}
+	if len(got.ents) != len(want.ents) {
+		t.Errorf("%s: there are %d entities, want %d",
+			what, len(got.ents), len(want.ents))
+	}
+	for id, e := range want.ents {
+		if got.ents[id] != e {
+			t.Errorf("%s: entity %d is %+v, want %+v",
+				what, id, got.ents[id], e)
+		}
+	}
+	if got.budgets != want.budgets {
+		t.Errorf("%s: the budgets are %+v, want %+v",
+			what, got.budgets, want.budgets)
+	}
+	if got.rule != want.rule {
+		t.Errorf("%s: the rule is %q, want %q", what, got.rule, want.rule)
+	}
+}
+
+// playJournaled plays a game through a Game PRAM that records its events in
+// the journal.  It returns the state of the world at each tick, just before
+// the tick's "LifeUpdate", and the tick that the speed went up at.
+func playJournaled(t *testing.T, j Journal) (map[int]worldState, int) {
+	w := newTestWorld(t)
+	w.War.RandomizeGameBoard(0)
+	g := NewGamePramWithJournal(w, j)
+	defer g.Stop()
+
+	// Once the game has answered a request, it is waiting for the next
+	// event, so the world can be looked at.
+	states := map[int]worldState{}
+	capture := func() {
+		g.RequestSomething("Seed")
+		states[w.War.Tick()] = stateOf(w)
+	}
+	event := func(a *AbstractEvent) {
+		r := make(chan interface{}, 1)
+		a.Response = r
+		g.CustomPlayerEvent(a)
+		<-r
+	}
+
+	one, _, _ := g.LoginEvent("")
+	two, _, _ := g.LoginEvent("")
+	fastTick := -1
+	for i := 0; i < 30; i++ {
+		switch i {
+		case 3:
+			event(&AbstractEvent{EventType: "LaBomba", SourceType: "Player",
+				SourceId: one, Location: Location{X: 5, Y: 5}})
+		case 8:
+			event(&AbstractEvent{EventType: "LaBomba", SourceType: "Player",
+				SourceId: two, Location: Location{X: 20, Y: 20}})
+		case 10:
+			event(&AbstractEvent{EventType: "SetRule", SourceType: "Admin",
+				EventBody: "B36/S23"})
+		case 12:
+			g.LoginEvent("")
+			g.LogoutEvent(one)
+		case 15:
+			event(&AbstractEvent{EventType: "SetRule", SourceType: "Admin",
+				EventBody: gameofwar.DEFAULT_RULE})
+		case 20:
+			event(&AbstractEvent{EventType: "SetSpeed", SourceType: "Admin",
+				Integer: 3})
+			fastTick = w.War.Tick()
+		}
+		capture()
+		g.UpdateLifeEvent()
+	}
+	capture()
+	return states, fastTick
+}
+
+// checkReplay replays the journal to each tick that was seen while playing,
+// and to the ticks in the middle of the faster "LifeUpdate" events.
+func checkReplay(t *testing.T, entries []JournalEntry,
+	states map[int]worldState, fastTick int) {
+
+	for tick, want := range states {
+		w, err := Replay(entries, tick)
+		if err != nil {
+			t.Fatalf("tick %d: %v", tick, err)
+		}
+		what := fmt.Sprintf("replayed to tick %d", tick)
+		compareStates(t, what, stateOf(w), want)
+	}
+
+	// At 3 generations per tick, the world never stopped on fastTick+1,
+	// so it is checked by moving the replay of fastTick one generation.
+	for tick := fastTick; tick < fastTick+3; tick++ {
+		w, err := Replay(entries, tick)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.War.SetSpeed(1)
+		w.War.LifeUpdate()
+		next, err := Replay(entries, tick+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		what := fmt.Sprintf("stopped in the middle, at tick %d", tick+1)
+		compareStates(t, what, stateOf(next), stateOf(w))
+	}
+
+	if _, err := Replay(entries, -1); err == nil {
+		t.Errorf("a replay from before the journal started didn't fail")
+	}
+}
+
+func TestReplayMemoryJournal(t *testing.T) {
+	j := NewMemoryJournal()
+	states, fastTick := playJournaled(t, j)
+	entries, err := j.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReplay(t, entries, states, fastTick)
+}
+
+func TestReplayFileJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "game-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "room.journal")
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	states, fastTick := playJournaled(t, j)
+
+	// The Game PRAM has closed the journal, so it is read from the file.
+	entries, err := ReadJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReplay(t, entries, states, fastTick)
+}
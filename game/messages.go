@@ -5,10 +5,15 @@ package game
 
 import (
 	"encoding/json"
+	"log"
+
+	"github.com/fractalbach/fractalnet/cellular/gameofwar"
 )
 
+// ChatMessage is a chat message, and its Id in the room's chat history.
 type ChatMessage struct {
 	Chat string
+	Id   int
 }
 
 // Message is the result of a JSON Marshalling.
@@ -21,6 +26,157 @@ type Message struct {
 	Body interface{}
 }
 
+// TeamMessage tells a client which team they have been assigned to.
+type TeamMessage struct {
+	Team uint8
+}
+
+// PlayerLogin is the response to a "Login" event.  If PlayerId is 0, then
+// the login has failed.
+type PlayerLogin struct {
+	PlayerId int
+	Team     uint8
+	Username string
+}
+
+// Error codes are the machine-readable part of an EventError.
+const (
+	ErrInvalidJson  = "InvalidJson"  // The message was not valid json.
+	ErrBadEvent     = "BadEvent"     // The json could not become an event.
+	ErrNotLoggedIn  = "NotLoggedIn"  // The sender has no player entity.
+	ErrUnknownEvent = "UnknownEvent" // Nothing handles that EventType.
+	ErrNotAllowed   = "NotAllowed"   // Only the server can send that event.
+	ErrFailed       = "Failed"       // The event was valid, but didn't work.
+	ErrNotOnTeam    = "NotOnTeam"    // The sender hasn't been given a team.
+	ErrWrongTeam    = "WrongTeam"    // The value belongs to the other team.
+	ErrIllegalValue = "IllegalValue" // Players can't place that value.
+
+	ErrOutOfRange     = "OutOfRange"     // A number is too small or large.
+	ErrCooldown       = "Cooldown"       // The team's bombs are cooling down.
+	ErrNoResources    = "NoResources"    // The team can't afford a bomb.
+	ErrUnknownCommand = "UnknownCommand" // There is no such chat command.
+	ErrBadCommand     = "BadCommand"     // The chat command was misused.
+	ErrUnknownRule    = "UnknownRule"    // No rule has that name or rulestring.
+	ErrBadPattern     = "BadPattern"     // The pattern has no name or can't be read.
+)
+
+// PatternState is a part of the grid, written as a pattern.  Format is
+// "rle" or "cells", and Text is the pattern in that format.
+type PatternState struct {
+	Format string
+	Width  int
+	Height int
+	Text   string
+}
+
+// PatternMessage is the response to an "ExportPattern" event.  It is only
+// sent to the player who asked for it.
+type PatternMessage struct {
+	Pattern PatternState
+}
+
+// SnapshotLoadedState tells which snapshot was loaded into the room, and by
+// whom.  Tick is the tick that the snapshot was saved on.
+type SnapshotLoadedState struct {
+	Name string
+	By   string
+	Tick int
+}
+
+// SnapshotLoadedMessage is broadcast to everyone after a "LoadSnapshot"
+// event.  It is followed by the Seed, Playback, Rule, Round and Score of
+// the loaded world, and its grid.
+type SnapshotLoadedMessage struct {
+	SnapshotLoaded SnapshotLoadedState
+}
+
+// PlaybackState describes whether the game is running, and how fast.
+// Event is the event that changed it, and By is the name of the player who
+// sent that event.  Both are empty when nothing has changed.
+type PlaybackState struct {
+	Paused bool
+	Speed  int
+	Tick   int
+	Event  string
+	By     string
+}
+
+// PlaybackMessage is broadcast to everyone after a "Pause", "Resume",
+// "Step" or "SetSpeed" event, and sent to each client when they join.
+type PlaybackMessage struct {
+	Playback PlaybackState
+}
+
+// SeedMessage is sent to each client when they join.  Seed started the
+// room's random number generator: a room started with the same seed makes
+// the same boards and guest names.
+type SeedMessage struct {
+	Seed int64
+}
+
+// RuleState is the name or rulestring of the rule that the grid follows.
+// By is the name of the player who changed it, or empty when nothing has
+// changed.
+type RuleState struct {
+	Name string
+	By   string
+}
+
+// RuleMessage is broadcast to everyone after a "SetRule" event, and sent to
+// each client when they join.
+type RuleMessage struct {
+	Rule RuleState
+}
+
+// RoundMessage is broadcast to everyone when the phase of the round changes,
+// and sent to each client when they join.
+type RoundMessage struct {
+	Round gameofwar.RoundState
+}
+
+// ScoreMessage is broadcast to everyone when the territory or the budget of
+// a team has changed.  It is checked once per tick.
+type ScoreMessage struct {
+	Score  gameofwar.Score
+	Budget gameofwar.Budgets
+	Tick   int
+}
+
+// GameOverMessage is broadcast to everyone when a round has finished, with
+// the winner and the final scores.
+type GameOverMessage struct {
+	GameOver gameofwar.RoundResult
+}
+
+// EventAck confirms that an event was received and done.
+type EventAck struct {
+	EventId   int
+	EventType string
+}
+
+// EventError explains why an event was not done.  The Code is one of the
+// Err constants, and the Reason is meant to be read by people.
+type EventError struct {
+	EventId   int
+	EventType string
+	Code      string
+	Reason    string
+}
+
+func (e *EventError) Error() string {
+	return e.Code + ": " + e.Reason
+}
+
+// AckMessage is the reply sent to a client when their event succeeds.
+type AckMessage struct {
+	Ack EventAck
+}
+
+// ErrorMessage is the reply sent to a client when their event fails.
+type ErrorMessage struct {
+	Error EventError
+}
+
 type SingleChange struct {
 	Value    uint8
 	Location Location
@@ -31,9 +187,9 @@ type SingleChange struct {
 //
 type AbstractEvent struct {
 
-	// EventId is a unique number used to compare different events going
-	// through the system.  Currently NOT IN USE.
-	//EventId int
+	// EventId is chosen by the client, and is copied into the Ack or Error
+	// reply, so that the client can tell which event the reply is for.
+	EventId int
 
 	// SourceId is usually the PlayerId of the client who sent initial request.
 	SourceId int
@@ -50,6 +206,10 @@ type AbstractEvent struct {
 	// GridLocation designates a specific x and y integer Location.
 	Location Location
 
+	// Width and Height are the size of a rectangle on the grid, with its
+	// top left corner at Location.
+	Width, Height int
+
 	// EventType distinguishes different kinds of events.
 	EventType string
 
@@ -108,6 +268,41 @@ func (a *AbstractEvent) SetSourceId(id int) {
 	a.SourceId = id
 }
 
+// NewError creates an EventError in reply to this event.
+func (a *AbstractEvent) NewError(code, reason string) *EventError {
+	return &EventError{
+		EventId:   a.EventId,
+		EventType: a.EventType,
+		Code:      code,
+		Reason:    reason,
+	}
+}
+
+// ReplyMessage converts the result of DoGameEvent into an Ack or an Error
+// message, encoded as json.  An EventError result becomes an Error message,
+// a false result becomes a "Failed" Error, and anything else is an Ack.
+func (a *AbstractEvent) ReplyMessage(result interface{}) []byte {
+	var v interface{}
+	switch r := result.(type) {
+	case *EventError:
+		v = ErrorMessage{*r}
+	case bool:
+		if r {
+			v = AckMessage{EventAck{a.EventId, a.EventType}}
+		} else {
+			v = ErrorMessage{*a.NewError(ErrFailed, "The event did not work.")}
+		}
+	default:
+		v = AckMessage{EventAck{a.EventId, a.EventType}}
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Println(err)
+		return []byte{}
+	}
+	return b
+}
+
 // _____________________________________________
 //  Has - I haz that
 // -------------------------------------------
@@ -0,0 +1,108 @@
+package game
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/fractalbach/fractalnet/cellular/gameofwar"
+)
+
+func TestReplyMessage(t *testing.T) {
+	a := &AbstractEvent{EventId: 7, EventType: "LaBomba"}
+	ack := `{"Ack":{"EventId":7,"EventType":"LaBomba"}}`
+	tests := []struct {
+		result interface{}
+		want   string
+	}{
+		{true, ack},
+		{[]byte("anything else"), ack},
+		{false, `{"Error":{"EventId":7,"EventType":"LaBomba",` +
+			`"Code":"Failed","Reason":"The event did not work."}}`},
+		{a.NewError(ErrWrongTeam, "Nope."), `{"Error":{"EventId":7,` +
+			`"EventType":"LaBomba","Code":"WrongTeam","Reason":"Nope."}}`},
+	}
+	for _, test := range tests {
+		if got := string(a.ReplyMessage(test.result)); got != test.want {
+			t.Errorf("reply to %#v is %s, want %s", test.result, got, test.want)
+		}
+	}
+}
+
+func TestPramRepliesToPlayers(t *testing.T) {
+	g := NewGamePram(Settings{Width: 48, Height: 48})
+	defer g.Stop()
+	id, team, _ := g.LoginEvent("player")
+	if id == 0 || !gameofwar.IsTeam(team) {
+		t.Fatalf("login returned player %d on team %d", id, team)
+	}
+
+	tests := []struct {
+		event AbstractEvent
+		ack   bool
+		code  string
+	}{
+		{AbstractEvent{EventId: 1, EventType: "LifeChange"}, true, ""},
+		{AbstractEvent{EventId: 2, EventType: "Nonsense"},
+			false, ErrUnknownEvent},
+		{AbstractEvent{EventId: 3, EventType: "Login"},
+			false, ErrNotAllowed},
+		{AbstractEvent{EventId: 4, EventType: "LifeChange", Value: 10},
+			false, ErrIllegalValue},
+	}
+	for _, test := range tests {
+		r := make(chan interface{}, 1)
+		event := test.event
+		event.SourceType = "Player"
+		event.SourceId = id
+		event.Response = r
+		g.CustomPlayerEvent(&event)
+
+		var reply struct {
+			Ack   *EventAck
+			Error *EventError
+		}
+		if err := json.Unmarshal((<-r).([]byte), &reply); err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case test.ack && (reply.Ack == nil ||
+			reply.Ack.EventId != event.EventId):
+			t.Errorf("%s got %+v, want an Ack for event %d",
+				event.EventType, reply, event.EventId)
+		case !test.ack && (reply.Error == nil ||
+			reply.Error.EventId != event.EventId ||
+			reply.Error.Code != test.code):
+			t.Errorf("%s got %+v, want a %s Error for event %d",
+				event.EventType, reply, test.code, event.EventId)
+		}
+	}
+}
+
+func TestPramAfterStop(t *testing.T) {
+	g := NewGamePram(Settings{Width: 48, Height: 48})
+	g.Stop()
+
+	// Nobody is listening anymore, so nothing should block.
+	done := make(chan bool)
+	go func() {
+		g.CustomPlayerEvent(&AbstractEvent{EventType: "LifeChange"})
+		g.UpdateLifeEvent()
+		g.LogoutEvent(1)
+		if id, _, _ := g.LoginEvent("late"); id != 0 {
+			t.Errorf("a stopped game logged in player %d", id)
+		}
+		if b := g.RequestSomething("GameState"); len(b) != 0 {
+			t.Errorf("a stopped game replied with %s", b)
+		}
+		if u := g.RequestGrid("LifeFrame"); u != nil {
+			t.Errorf("a stopped game replied with a grid")
+		}
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("sending events to a stopped game blocked")
+	}
+}
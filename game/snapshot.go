@@ -0,0 +1,297 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+
+	"github.com/fractalbach/fractalnet/cellular/gameofwar"
+)
+
+// SNAPSHOT_VERSION is the version of the WorldSnapshot format.  It goes up
+// whenever a snapshot can't be read the same way as before.  Snapshots from
+// before there were versions have a version of 0.
+const SNAPSHOT_VERSION = 1
+
+// WorldSnapshot holds everything needed to rebuild a World, in a form that
+// can be converted into json.
+type WorldSnapshot struct {
+
+	// Version is the SNAPSHOT_VERSION that the snapshot was saved with.
+	Version int
+
+	Ents   map[int]*Ent
+	NextId int
+	Width  int
+	Height int
+
+	// Tick is the number of generations that have passed in the Game of War,
+	// and Cells is its field, one byte per cell, row by row.
+	Tick  int
+	Cells []byte
+
+	// Paused and Speed are the playback controls of the Game of War.
+	Paused bool
+	Speed  int
+
+	// Round is the phase, start and result of the current round.
+	Round gameofwar.RoundState
+
+	// Budgets are the resources and bomb cooldowns of each team.
+	Budgets *gameofwar.Budgets
+
+	// Rule is the name of the rule that the grid follows, and Topology is
+	// what is past its edges.
+	Rule     string
+	Topology string
+
+	// Seed started the world's random number generator, and Draws is the
+	// number of random numbers that had been drawn from it.  Snapshots from
+	// before there was a count start over from the seed.
+	Seed  int64
+	Draws uint64
+
+	// Victory and Economy are the settings of the Game of War.  Snapshots
+	// from before version 1 don't have them.
+	Victory *gameofwar.VictoryConditions
+	Economy *gameofwar.Economy
+}
+
+// Snapshot copies the world into a WorldSnapshot.
+func (w *World) Snapshot() *WorldSnapshot {
+	ents := make(map[int]*Ent, len(w.Ents))
+	for id, e := range w.Ents {
+		copied := *e
+		ents[id] = &copied
+	}
+	snap := &WorldSnapshot{
+		Version:  SNAPSHOT_VERSION,
+		Ents:     ents,
+		NextId:   w.nextid,
+		Width:    w.w,
+		Height:   w.h,
+		Tick:     w.War.Tick(),
+		Cells:    w.War.Cells(),
+		Paused:   w.War.Paused(),
+		Speed:    w.War.Speed(),
+		Round:    w.War.Round(),
+		Rule:     w.War.Rule(),
+		Topology: w.War.Topology(),
+		Seed:     w.seed,
+		Draws:    w.source.draws,
+	}
+	budgets := w.War.Budgets()
+	victory := w.War.VictoryConditions()
+	economy := w.War.Economy()
+	snap.Budgets, snap.Victory, snap.Economy = &budgets, &victory, &economy
+	return snap
+}
+
+// RestoreWorld rebuilds a World from a snapshot.  The world keeps the size,
+// the rule, the topology, the victory conditions and the economy from the
+// snapshot.  Older snapshots that don't have some of them get them from the
+// settings.
+//
+// The random number generator picks up where it left off, so that it
+// doesn't give out the same guest names and boards again.
+func RestoreWorld(s *WorldSnapshot, settings Settings) (*World, error) {
+	if s.Version > SNAPSHOT_VERSION {
+		return nil, fmt.Errorf("the snapshot has version %d, but this server "+
+			"only knows up to version %d", s.Version, SNAPSHOT_VERSION)
+	}
+	// The size is checked before anything is made, since a snapshot can be
+	// corrupt, and a world with a huge size would use up all of the memory.
+	if s.Width <= 0 || s.Height <= 0 ||
+		s.Width > MAX_WORLD_SIZE || s.Height > MAX_WORLD_SIZE {
+		return nil, fmt.Errorf("the snapshot is %d x %d, but worlds must be "+
+			"between 1 x 1 and %d x %d", s.Width, s.Height,
+			MAX_WORLD_SIZE, MAX_WORLD_SIZE)
+	}
+	if len(s.Cells) != s.Width*s.Height {
+		return nil, fmt.Errorf("the snapshot has %d cells, but a %d x %d "+
+			"world needs %d", len(s.Cells), s.Width, s.Height,
+			s.Width*s.Height)
+	}
+	if s.Victory != nil {
+		settings.Victory = *s.Victory
+	}
+	if s.Economy != nil {
+		settings.Economy = *s.Economy
+	}
+	seed := s.Seed
+	if seed == 0 {
+		seed = pickSeed(settings.Seed)
+	}
+	source := newCountingSource(seed)
+	rng := rand.New(source)
+	// The entities are copied, like in Snapshot, so that the same snapshot
+	// can be restored again (as Replay does) without seeing this world.
+	ents := make(map[int]*Ent, len(s.Ents))
+	for id, e := range s.Ents {
+		if e == nil {
+			continue
+		}
+		copied := *e
+		ents[id] = &copied
+	}
+	w := &World{
+		Ents:     ents,
+		nextid:   s.NextId,
+		w:        s.Width,
+		h:        s.Height,
+		rng:      rng,
+		seed:     seed,
+		source:   source,
+		settings: settings,
+		War:      gameofwar.NewGameInstance(s.Width, s.Height, rng),
+	}
+	if w.nextid < 1 {
+		w.nextid = 1
+	}
+	// Making the Game of War can draw random numbers too, so the generator
+	// is moved forward once the world has been made.
+	source.skipTo(seed, s.Draws)
+	err := w.War.LoadCells(s.Cells, s.Tick)
+	if err != nil {
+		return nil, err
+	}
+	rule := s.Rule
+	if rule == "" {
+		rule = settings.Rule
+	}
+	if rule != "" {
+		if err := w.War.SetRule(rule); err != nil {
+			return nil, err
+		}
+	}
+	topology := s.Topology
+	if topology == "" {
+		topology = settings.Topology
+	}
+	if err := w.War.SetTopology(topology); err != nil {
+		return nil, err
+	}
+	if s.Speed != 0 {
+		w.War.SetSpeed(s.Speed)
+	}
+	if s.Paused {
+		w.War.Pause()
+	}
+	w.War.LoadRound(s.Round)
+	w.War.SetVictoryConditions(settings.Victory)
+	w.War.SetEconomy(settings.Economy)
+	if s.Budgets != nil {
+		w.War.LoadBudgets(*s.Budgets)
+	}
+	w.score, w.budgets = w.War.Territory(), w.War.Budgets()
+	return w, nil
+}
+
+// Save writes the world to out, as a json WorldSnapshot.
+func (w *World) Save(out io.Writer) error {
+	return json.NewEncoder(out).Encode(w.Snapshot())
+}
+
+// Load replaces the world with a snapshot that was written by Save.  If
+// the snapshot can't be read, then the world is left as it was.  Settings
+// that an older snapshot doesn't have are kept from the world.
+func (w *World) Load(in io.Reader) error {
+	var s WorldSnapshot
+	if err := json.NewDecoder(in).Decode(&s); err != nil {
+		return err
+	}
+	loaded, err := RestoreWorld(&s, w.settings)
+	if err != nil {
+		return err
+	}
+	loaded.announcements = w.announcements
+	*w = *loaded
+	return nil
+}
+
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+//      Named Snapshots
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+// MAX_SNAPSHOT_NAME is the longest name that a saved snapshot can have.
+const MAX_SNAPSHOT_NAME = 64
+
+// snapshotPath returns the file of the named snapshot, in the world's
+// snapshot directory.  Names are only letters, digits, '-' and '_', so
+// that they can't point anywhere else.
+func (w *World) snapshotPath(name string) (string, error) {
+	if w.settings.SnapshotDir == "" {
+		return "", fmt.Errorf("this server doesn't keep snapshots")
+	}
+	if name == "" || len(name) > MAX_SNAPSHOT_NAME {
+		return "", fmt.Errorf("snapshot names have 1 to %d letters",
+			MAX_SNAPSHOT_NAME)
+	}
+	for _, r := range name {
+		ok := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' ||
+			r >= '0' && r <= '9' || r == '-' || r == '_'
+		if !ok {
+			return "", fmt.Errorf("snapshot names can only have letters, " +
+				"digits, '-' and '_'")
+		}
+	}
+	return filepath.Join(w.settings.SnapshotDir, name+".json"), nil
+}
+
+// saveNamed saves the world as a named snapshot, replacing any snapshot
+// that had the same name.
+func (w *World) saveNamed(name string) error {
+	path, err := w.snapshotPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(w.settings.SnapshotDir, 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(w.settings.SnapshotDir, name+".tmp")
+	if err != nil {
+		return err
+	}
+	err = w.Save(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// loadNamed replaces the world with a named snapshot.  The players who are
+// in the world stay in it, with their teams, and the players that were
+// saved in the snapshot are left out.
+func (w *World) loadNamed(name string) error {
+	path, err := w.snapshotPath(name)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("there is no snapshot called %q", name)
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	ents, nextid := w.Ents, w.nextid
+	if err := w.Load(f); err != nil {
+		return err
+	}
+	w.Ents = ents
+	if nextid > w.nextid {
+		w.nextid = nextid
+	}
+	return nil
+}
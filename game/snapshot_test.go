@@ -0,0 +1,135 @@
+package game
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	w := newTestWorld(t)
+	var buf bytes.Buffer
+	if err := w.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded := MakeNewWorld(Settings{Width: 8, Height: 8, Seed: 2})
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.MapWidth() != w.MapWidth() ||
+		loaded.MapHeight() != w.MapHeight() {
+		t.Errorf("the loaded world is %d x %d, want %d x %d",
+			loaded.MapWidth(), loaded.MapHeight(), w.MapWidth(), w.MapHeight())
+	}
+	if !bytes.Equal(loaded.War.Cells(), w.War.Cells()) {
+		t.Errorf("the loaded world has different cells")
+	}
+	if loaded.War.Tick() != w.War.Tick() {
+		t.Errorf("the loaded world is at tick %d, want %d",
+			loaded.War.Tick(), w.War.Tick())
+	}
+}
+
+func TestRestoreCorruptSnapshot(t *testing.T) {
+	cells := func(n int) []byte { return make([]byte, n) }
+	tests := []struct {
+		name string
+		snap WorldSnapshot
+		want string
+	}{
+		{"zero size", WorldSnapshot{Width: 0, Height: 0}, "between"},
+		{"negative size", WorldSnapshot{Width: -16, Height: 16,
+			Cells: cells(0)}, "between"},
+		{"huge size", WorldSnapshot{Width: MAX_WORLD_SIZE << 10,
+			Height: MAX_WORLD_SIZE << 10}, "between"},
+		{"too wide", WorldSnapshot{Width: MAX_WORLD_SIZE + 1, Height: 1,
+			Cells: cells(MAX_WORLD_SIZE + 1)}, "between"},
+		{"too few cells", WorldSnapshot{Width: 16, Height: 16,
+			Cells: cells(255)}, "cells"},
+		{"too many cells", WorldSnapshot{Width: 16, Height: 16,
+			Cells: cells(257)}, "cells"},
+		{"no cells", WorldSnapshot{Width: 16, Height: 16}, "cells"},
+		{"from the future", WorldSnapshot{Version: SNAPSHOT_VERSION + 1,
+			Width: 16, Height: 16, Cells: cells(256)}, "version"},
+	}
+	for _, tt := range tests {
+		w, err := RestoreWorld(&tt.snap, Settings{})
+		if err == nil {
+			t.Errorf("%s: RestoreWorld made a %d x %d world",
+				tt.name, w.MapWidth(), w.MapHeight())
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got the error %q, want one about %q",
+				tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestLoadCorruptSnapshotKeepsWorld(t *testing.T) {
+	w := newTestWorld(t)
+	before := w.War.Cells()
+	corrupt := `{"Version": 1, "Width": 1099511627776, "Height": 2,
+		"Cells": ""}`
+	if err := w.Load(strings.NewReader(corrupt)); err == nil {
+		t.Fatal("a corrupt snapshot was loaded")
+	}
+	if w.MapWidth() != 32 || !bytes.Equal(w.War.Cells(), before) {
+		t.Errorf("loading a corrupt snapshot changed the world")
+	}
+}
+
+// guestNames logs in n guests, and returns the names that they were given.
+func guestNames(w *World, n int) []string {
+	names := []string{}
+	for i := 0; i < n; i++ {
+		r := make(chan interface{}, 1)
+		w.DoGameEvent(&AbstractEvent{EventType: "Login", Response: r})
+		names = append(names, (<-r).(PlayerLogin).Username)
+	}
+	return names
+}
+
+func TestSameSeedSameWorld(t *testing.T) {
+	worlds := []*World{}
+	for i := 0; i < 2; i++ {
+		w := MakeNewWorld(Settings{Width: 64, Height: 48, Seed: 42})
+		w.War.RandomizeGameBoard(0)
+		worlds = append(worlds, w)
+	}
+	if !bytes.Equal(worlds[0].War.Cells(), worlds[1].War.Cells()) {
+		t.Errorf("worlds with the same seed made different boards")
+	}
+	a, b := guestNames(worlds[0], 10), guestNames(worlds[1], 10)
+	if strings.Join(a, ",") != strings.Join(b, ",") {
+		t.Errorf("worlds with the same seed gave out different names:\n"+
+			"%q\n%q", a, b)
+	}
+
+	other := MakeNewWorld(Settings{Width: 64, Height: 48, Seed: 43})
+	other.War.RandomizeGameBoard(0)
+	if bytes.Equal(worlds[0].War.Cells(), other.War.Cells()) {
+		t.Errorf("worlds with different seeds made the same board")
+	}
+}
+
+func TestRestoredWorldPicksUpTheSeed(t *testing.T) {
+	settings := Settings{Width: 32, Height: 32, Seed: 7}
+	want := guestNames(MakeNewWorld(settings), 6)
+
+	w := MakeNewWorld(settings)
+	before := guestNames(w, 3)
+	var buf bytes.Buffer
+	if err := w.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded := MakeNewWorld(settings)
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got := append(before, guestNames(loaded, 3)...)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("a restored world gave out the names\n%q, want\n%q",
+			got, want)
+	}
+}
@@ -9,8 +9,12 @@ Compressing Boolean Matrices to Base 64:
 package game
 
 import (
-	"crypto/rand"
 	"fmt"
+	"math/rand"
+
+	"github.com/fractalbach/fractalnet/cellular/bitlife"
+	"github.com/fractalbach/fractalnet/cellular/engine"
+	"github.com/fractalbach/fractalnet/cellular/hashlife"
 )
 
 // tree is basically just an x and y location,
@@ -30,36 +34,59 @@ type TreeList struct {
 	Trees []tree
 }
 
+// BoolGrid is a grid of trees.  Its cells are kept in an engine.Buffer,
+// row by row, where 1 is a tree and 0 is empty.
 type BoolGrid struct {
-	w, h int
-	grid [][]bool
+	w, h  int
+	cells engine.Buffer
+
+	// topology decides what is past the edges: see the engine package.
+	topology string
+}
+
+// SetTopology changes what the trees on the edge see past the edge:
+// nothing (bounded), the other side (torus), or themselves (mirror).
+func (b *BoolGrid) SetTopology(t string) error {
+	if err := engine.ValidTopology(t); err != nil {
+		return err
+	}
+	b.topology = t
+	return nil
 }
 
 func (b *BoolGrid) Set(x, y int, v bool) {
-	b.grid[x][y] = v
+	b.cells.Set(x, y, boolToCell(v))
+}
+
+// boolToCell returns 1 for a tree, and 0 for an empty cell.
+func boolToCell(v bool) uint8 {
+	if v {
+		return 1
+	}
+	return 0
 }
 
 // CreateInitialTrees outputs a Randomized Boolean Grid pointer.
 //
 // The boolean grid is actually a matrix, of size w * h.
 //
-func CreateRandomInitialTrees(w, h int) *BoolGrid {
-	bg := ConvertToBoolGridType(MakeRandomBoolGrid(w, h))
+func CreateRandomInitialTrees(w, h int, rng *rand.Rand) *BoolGrid {
+	bg := ConvertToBoolGridType(MakeRandomBoolGrid(w, h, rng))
 	bg.NextGeneration()
 	return bg
 }
 
-func GenerateRandomTree(w, h int) tree {
+func GenerateRandomTree(w, h int, rng *rand.Rand) tree {
 	return tree{
-		x: gimmeRandom(w),
-		y: gimmeRandom(h),
+		x: rng.Intn(w),
+		y: rng.Intn(h),
 	}
 }
 
-func MakeTreeList(w, h, TreesToMake int) *TreeList {
+func MakeTreeList(w, h, TreesToMake int, rng *rand.Rand) *TreeList {
 	var treeMap []tree
 	for i := 0; i < TreesToMake; i++ {
-		treeMap = append(treeMap, GenerateRandomTree(w, h))
+		treeMap = append(treeMap, GenerateRandomTree(w, h, rng))
 	}
 	return &TreeList{
 		w:     w,
@@ -68,21 +95,16 @@ func MakeTreeList(w, h, TreesToMake int) *TreeList {
 	}
 }
 
-// MakeBoolGrid creates a 2-d array, where each array is a horizontal!
-// Keep in mind that each grid[x] would appear as a column.
-//
+// MakeBoolGrid creates a grid with a tree at each (x,y) of the list.
 func (tl *TreeList) MakeBoolGrid() *BoolGrid {
-	grid := make([][]bool, tl.w)
-	for i := range grid {
-		grid[i] = make([]bool, tl.h)
-	}
+	cells := engine.NewBuffer(tl.w, tl.h)
 	for _, v := range tl.Trees {
-		grid[v.x][v.y] = true
+		cells.Set(v.x, v.y, 1)
 	}
 	return &BoolGrid{
-		w:    tl.w,
-		h:    tl.h,
-		grid: grid,
+		w:     tl.w,
+		h:     tl.h,
+		cells: cells,
 	}
 }
 
@@ -113,23 +135,69 @@ The Rules of the Game of Life
 
 */
 func (b *BoolGrid) NextGeneration() {
-	future := BoolGrid{
-		w:    b.w,
-		h:    b.h,
-		grid: MakeEmptyBoolGrid(b.w, b.h),
+	b.NextGenerations(1)
+}
+
+// NextGenerations moves the trees forward by n generations at once, on a
+// bit board, which keeps 64 trees in a word.  It only converts the grid to
+// and from the bit board once, so big forests should be grown this way.
+func (b *BoolGrid) NextGenerations(n int) {
+	board := b.Board()
+	board.StepN(n)
+	b.cells = board.Buffer()
+}
+
+// Board returns the trees on a bit board, with the same topology.
+func (b *BoolGrid) Board() *bitlife.Board {
+	board := bitlife.FromBuffer(b.cells)
+	board.SetTopology(b.topology)
+	return board
+}
+
+// BoolGridFromBoard returns a grid with a tree for every living cell of the
+// bit board, and the same topology.
+func BoolGridFromBoard(board *bitlife.Board) *BoolGrid {
+	return &BoolGrid{
+		w:        board.Width(),
+		h:        board.Height(),
+		cells:    board.Buffer(),
+		topology: board.Topology(),
 	}
-	for i := 0; i < b.w; i++ {
-		for j := 0; j < b.h; j++ {
-			c := b.CountLivingNeighbors(i, j)
-			if (c == 3) || ((c == 2) && (b.grid[i][j])) {
-				future.grid[i][j] = true
-			} else {
-				future.grid[i][j] = false
-			}
-			//fmt.Println("(x,y):",i,j,"(neighbors):", c,"(past):", b.grid[i][j],"(future):", future.grid[i][j])
+}
+
+// Universe returns the trees on a HashLife universe, with the top left
+// corner of the grid at (0,0).  The universe has no edges, so it is only
+// the same as the grid until the trees grow past the edge of the grid.
+func (b *BoolGrid) Universe() *hashlife.Universe {
+	return hashlife.FromBuffer(b.cells)
+}
+
+// Preview returns what the trees will look like in n generations, without
+// changing them.  Since it uses HashLife, n can be in the millions.  Trees
+// that grow past the edges are cut off, instead of wrapping around.
+func (b *BoolGrid) Preview(n int64) (*BoolGrid, error) {
+	u := b.Universe()
+	if err := u.Advance(n); err != nil {
+		return nil, err
+	}
+	return &BoolGrid{
+		w:        b.w,
+		h:        b.h,
+		cells:    u.Buffer(0, 0, b.w, b.h),
+		topology: b.topology,
+	}, nil
+}
+
+// Bools returns the trees as a boolean matrix, where [x][y] is the cell at
+// (x,y), like the ones that CompressBoolGrid takes.
+func (b *BoolGrid) Bools() [][]bool {
+	grid := MakeEmptyBoolGrid(b.w, b.h)
+	for x := range grid {
+		for y := range grid[x] {
+			grid[x][y] = b.cells.At(x, y) != 0
 		}
 	}
-	b.grid = future.grid
+	return grid
 }
 
 // CountLivingNeighbors returns an integer in [0, 4].
@@ -156,8 +224,16 @@ func (b *BoolGrid) CountLivingNeighbors(x, y int) int {
 }
 
 // Alive reports whether the specified cell is alive, it simply calls another
-// function: one of the other "Alive" functions with specific rules.
+// function: one of the other "Alive" functions with specific rules, which
+// depends on the topology of the grid.
 func (b *BoolGrid) Alive(x, y int) bool {
+	switch b.topology {
+	case engine.TOPOLOGY_TORUS:
+		return b.AliveWrap(x, y)
+	case engine.TOPOLOGY_MIRROR:
+		x, y, _ = engine.Wrap(b.topology, x, y, b.w, b.h)
+		return b.cells.At(x, y) != 0
+	}
 	return b.AliveNoWrap(x, y)
 }
 
@@ -167,7 +243,7 @@ func (b *BoolGrid) AliveNoWrap(x, y int) bool {
 	if (x < 0) || (y < 0) || (x >= b.w) || (y >= b.h) {
 		return false
 	}
-	return b.grid[x][y]
+	return b.cells.At(x, y) != 0
 }
 
 // AliveWrap reports whether the specified cell is alive.  It treats the world
@@ -182,14 +258,7 @@ func (b *BoolGrid) AliveWrap(x, y int) bool {
 	x %= b.w
 	y += b.h
 	y %= b.h
-	return b.grid[x][y]
-}
-
-// gimmeRandom returns a random int \in [0, max], max <= 1024
-func gimmeRandom(max int) int {
-	a := make([]byte, 3)
-	rand.Read(a)
-	return int(a[0]+a[1]+a[2]) % max
+	return b.cells.At(x, y) != 0
 }
 
 func (tl *TreeList) prettyPrint() {
@@ -199,7 +268,7 @@ func (tl *TreeList) prettyPrint() {
 func (b *BoolGrid) prettyPrint() {
 	for i := 0; i < b.w; i++ {
 		for j := 0; j < b.h; j++ {
-			if b.grid[i][j] {
+			if b.cells.At(i, j) != 0 {
 				fmt.Print("█")
 			} else {
 				fmt.Print(" ")
@@ -232,12 +301,23 @@ func makeMyExample() *TreeList {
 	}
 }
 
-// Just a hack, need to get rid of the boolgrid type at some point.
+// ConvertToBoolGridType copies a boolean matrix, where bg[x][y] is the cell
+// at (x,y), into a BoolGrid.
 func ConvertToBoolGridType(bg [][]bool) *BoolGrid {
+	w, h := len(bg), 0
+	if w > 0 {
+		h = len(bg[0])
+	}
+	cells := engine.NewBuffer(w, h)
+	for x := range bg {
+		for y, v := range bg[x] {
+			cells.Set(x, y, boolToCell(v))
+		}
+	}
 	return &BoolGrid{
-		w:    len(bg),
-		h:    len(bg[0]),
-		grid: bg,
+		w:     w,
+		h:     h,
+		cells: cells,
 	}
 }
 
@@ -4,7 +4,7 @@ package namegen
 
 import (
     //"fmt"
-    "crypto/rand"
+    "math/rand"
 )
 
 
@@ -158,19 +158,13 @@ var nouns = []string {
 }
 
 
-// gimmeRandom creates random bytes from the crypto package,
-// and then converts that into an integer within the maximum range [0, max].
-// NOTE:  0 < max < 255
-func gimmeRandom(max int) int {
-    a := make([]byte, 1)
-    rand.Read(a)
-    return int(a[0]) % max
-}
-
-func GenerateUsername() string {
-    a := adjectives[gimmeRandom(len(adjectives)- 1)]
-    n := nouns[gimmeRandom(len(nouns) - 1)]
-    return a + " " + n 
+// GenerateUsernameFrom makes up a username: an adjective and an animal,
+// picked by the given random number generator.  Generators with the same
+// seed pick the same names, in the same order.
+func GenerateUsernameFrom(r *rand.Rand) string {
+    a := adjectives[r.Intn(len(adjectives))]
+    n := nouns[r.Intn(len(nouns))]
+    return a + " " + n
 }
 
 
@@ -183,12 +177,13 @@ func GenerateUsername() string {
 // }
 
 
-// Note: the regular pseudo-random number gen would need a seed like this:
-// rand.Seed(time.Now().UTC().UnixNano())
+// Note: the names come from a generator that is passed in, so that the
+// game can pick the same names again when it is played back from its seed.
 
 
 // func main() {
+//     r := rand.New(rand.NewSource(1))
 //     for i := 0; i < 10; i++ {
-//         fmt.Println( GenerateUsername() )
+//         fmt.Println( GenerateUsernameFrom(r) )
 //     }
 // }
@@ -0,0 +1,196 @@
+package wschat
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ChatEntry is a single chat message, with the id that the store gave it.
+// Ids start at 1, and each new message gets the next id.
+type ChatEntry struct {
+	Id   int
+	Chat string
+}
+
+// ChatHistoryMessage is a page of chat history, oldest message first.
+type ChatHistoryMessage struct {
+	ChatHistory []ChatEntry
+}
+
+// ChatStore keeps the chat history of a room.  It is safe to use from
+// multiple goroutines.
+type ChatStore interface {
+
+	// Append saves a new message, and returns it with its id.
+	Append(chat string) (ChatEntry, error)
+
+	// Before returns up to n messages with ids smaller than the given id,
+	// oldest first.  An id of 0 means "before the newest message", so that
+	// Before(0, n) returns the last n messages.
+	Before(id, n int) ([]ChatEntry, error)
+
+	// Close releases the store.  It can't be used after that.
+	Close() error
+}
+
+// openChatStore opens the chat store of a room.  If the directory is empty,
+// then the chat history is only kept in memory.
+func openChatStore(dir, room string) (ChatStore, error) {
+	if dir == "" {
+		return &memoryChatStore{}, nil
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return openFileChatStore(filepath.Join(dir, room+".chat"))
+}
+
+// pageRange returns the range of ids [from, to) for a call to Before, when
+// the store has the given number of messages.
+func pageRange(id, n, count int) (int, int) {
+	if id <= 0 || id > count+1 {
+		id = count + 1
+	}
+	from := id - n
+	if from < 1 {
+		from = 1
+	}
+	return from, id
+}
+
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+//      Memory Chat Store
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+// memoryChatStore keeps the chat history in memory; it is lost on restart.
+type memoryChatStore struct {
+	mu      sync.Mutex
+	entries []ChatEntry
+}
+
+func (m *memoryChatStore) Append(chat string) (ChatEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := ChatEntry{Id: len(m.entries) + 1, Chat: chat}
+	m.entries = append(m.entries, e)
+	return e, nil
+}
+
+func (m *memoryChatStore) Before(id, n int) ([]ChatEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	from, to := pageRange(id, n, len(m.entries))
+	page := make([]ChatEntry, to-from)
+	copy(page, m.entries[from-1:to-1])
+	return page, nil
+}
+
+func (m *memoryChatStore) Close() error {
+	return nil
+}
+
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+//      File Chat Store
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+// fileChatStore is an append-only file, with one json ChatEntry per line.
+// Only the position of each line is kept in memory, so that pages can be
+// read from the file without reading the whole thing.
+type fileChatStore struct {
+	mu sync.Mutex
+	f  *os.File
+
+	// offsets[i] is the position of the line for the message with id i+1.
+	offsets []int64
+
+	// size is the position where the next line will be written.
+	size int64
+}
+
+// openFileChatStore opens (or creates) a chat history file.  If the last
+// line was only partly written, then it is thrown away.
+func openFileChatStore(path string) (*fileChatStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &fileChatStore{f: f}
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		s.offsets = append(s.offsets, s.size)
+		s.size += int64(len(line))
+	}
+	err = f.Truncate(s.size)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileChatStore) Append(chat string) (ChatEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := ChatEntry{Id: len(s.offsets) + 1, Chat: chat}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return e, err
+	}
+	b = append(b, '\n')
+	_, err = s.f.WriteAt(b, s.size)
+	if err != nil {
+		return e, err
+	}
+	s.offsets = append(s.offsets, s.size)
+	s.size += int64(len(b))
+	return e, nil
+}
+
+func (s *fileChatStore) Before(id, n int) ([]ChatEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	from, to := pageRange(id, n, len(s.offsets))
+	if from >= to {
+		return []ChatEntry{}, nil
+	}
+	start := s.offsets[from-1]
+	end := s.size
+	if to-1 < len(s.offsets) {
+		end = s.offsets[to-1]
+	}
+	buf := make([]byte, end-start)
+	_, err := s.f.ReadAt(buf, start)
+	if err != nil {
+		return nil, err
+	}
+	page := make([]ChatEntry, 0, to-from)
+	for _, line := range bytes.Split(bytes.TrimSuffix(buf, newline), newline) {
+		var e ChatEntry
+		err := json.Unmarshal(line, &e)
+		if err != nil {
+			return nil, err
+		}
+		page = append(page, e)
+	}
+	return page, nil
+}
+
+func (s *fileChatStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
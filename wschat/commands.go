@@ -0,0 +1,247 @@
+package wschat
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fractalbach/fractalnet/game"
+)
+
+// ===========================================================================
+//      Chat Commands
+// ___________________________________________________________________________
+//
+// Chat messages that start with a slash are commands, like "/nick Bob".
+// Commands are run by the room's goroutine, so that they can look at the
+// other clients in the room, and change a client's username, without
+// any locks.
+//
+// Every command gets an Ack or an Error, just like any other event.  The
+// replies that are only meant for the sender (like the output of "/who")
+// go through the sender's response channel, so they arrive before the Ack.
+
+// maxNicknameLength limits the size of the names chosen with "/nick".
+const maxNicknameLength = 24
+
+// NoticeMessage is a message from the server that is only meant for one
+// client, like the output of "/who" and "/help".
+type NoticeMessage struct {
+	Notice string
+}
+
+// WhisperMessage is a private chat message, sent with "/w".  It is only
+// sent to the sender and to the receiver, and it is never saved.
+type WhisperMessage struct {
+	Whisper string
+}
+
+// chatRequest carries a "Chat" or "ChatHistory" event to the room.
+type chatRequest struct {
+	client *Client
+	event  *game.AbstractEvent
+}
+
+// chatCommand is a single slash command.  run returns an empty string if
+// the command worked, or the reason why it didn't.
+type chatCommand struct {
+	name  string
+	usage string
+	help  string
+	run   func(r *Room, c *Client, args string) string
+}
+
+// chatCommands is filled in by init, because "/help" needs to read it.
+var chatCommands []chatCommand
+
+func init() {
+	chatCommands = []chatCommand{
+		{"/help", "/help", "lists the chat commands.", cmdHelp},
+		{"/me", "/me <action>", "describes what you are doing.", cmdMe},
+		{"/nick", "/nick <name>", "changes your name.", cmdNick},
+		{"/w", "/w <name> <message>", "whispers to another player.", cmdWhisper},
+		{"/who", "/who", "lists the players in this room.", cmdWho},
+	}
+}
+
+// findChatCommand returns the command with the given name, or nil.
+func findChatCommand(name string) *chatCommand {
+	for i := range chatCommands {
+		if chatCommands[i].name == name {
+			return &chatCommands[i]
+		}
+	}
+	return nil
+}
+
+// handleChat is called by the room for each "Chat" event.  Plain chat is
+// saved and broadcast; anything starting with a slash is a command.
+//
+// "ChatHistory" events are handled here as well, since the chat history
+// belongs to the room, and is written to by plain chat.
+func (r *Room) handleChat(c *Client, event *game.AbstractEvent) {
+	if event.EventType == "ChatHistory" {
+		c.response <- r.chatHistoryMessage(event.Integer, r.config.ChatHistory)
+		c.response <- event.ReplyMessage(true)
+		return
+	}
+	body := strings.TrimSpace(event.GetEventBody())
+	if !strings.HasPrefix(body, "/") {
+		r.sendToAll(r.saveChat(prettyNow() + " > " + c.username + ": " + body))
+		c.response <- event.ReplyMessage(true)
+		return
+	}
+
+	name, args := splitCommand(body)
+	cmd := findChatCommand(name)
+	if cmd == nil {
+		c.response <- event.ReplyMessage(event.NewError(game.ErrUnknownCommand,
+			"There is no command called "+name+".  Try /help."))
+		return
+	}
+	if reason := cmd.run(r, c, args); reason != "" {
+		c.response <- event.ReplyMessage(event.NewError(game.ErrBadCommand,
+			reason+"  Usage: "+cmd.usage))
+		return
+	}
+	c.response <- event.ReplyMessage(true)
+}
+
+// splitCommand splits "/name some args" into "/name" and "some args".
+func splitCommand(body string) (string, string) {
+	i := strings.IndexAny(body, " \t")
+	if i < 0 {
+		return body, ""
+	}
+	return body[:i], strings.TrimSpace(body[i+1:])
+}
+
+// notify sends a NoticeMessage to the client, through its response channel.
+func notify(c *Client, text string) {
+	b, err := json.Marshal(NoticeMessage{text})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	c.response <- b
+}
+
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+//      The Commands
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+func cmdHelp(r *Room, c *Client, args string) string {
+	lines := []string{"Chat Commands:"}
+	for _, cmd := range chatCommands {
+		lines = append(lines, cmd.usage+" - "+cmd.help)
+	}
+	notify(c, strings.Join(lines, "\n"))
+	return ""
+}
+
+func cmdMe(r *Room, c *Client, args string) string {
+	if args == "" {
+		return "What are you doing?"
+	}
+	r.sendToAll(r.saveChat(prettyNow() + " > * " + c.username + " " + args))
+	return ""
+}
+
+// cmdNick changes the client's username, and the name of their player
+// entity in the game.  Names must be unique inside of the room.
+func cmdNick(r *Room, c *Client, args string) string {
+	if !validNickname(args) {
+		return "Names can have up to " + strconv.Itoa(maxNicknameLength) +
+			" letters, digits, spaces, '-' and '_'."
+	}
+	if other := r.findClient(args); other != nil && other != c {
+		return "Somebody is already called " + args + "."
+	}
+	old := c.username
+	c.username = args
+	r.pram.RenameEvent(c.playerid, args)
+	log.Println("Renamed:", old, "to", args, "(ID):", c.playerid, "(Room):", r.name)
+	r.sendToAll(r.saveChat(prettyNow() + " > " + old + " is now known as " +
+		args + "."))
+	return ""
+}
+
+// cmdWhisper sends a private message.  Usernames can have spaces in them,
+// so the longest username that the arguments start with is the receiver.
+func cmdWhisper(r *Room, c *Client, args string) string {
+	var to *Client
+	for client := range r.clients {
+		name := client.username
+		if strings.HasPrefix(args, name+" ") &&
+			(to == nil || len(name) > len(to.username)) {
+			to = client
+		}
+	}
+	if to == nil {
+		return "Nobody in this room has that name."
+	}
+	text := strings.TrimSpace(args[len(to.username):])
+	b, err := json.Marshal(WhisperMessage{prettyNow() + " > " + c.username +
+		" whispers to " + to.username + ": " + text})
+	if err != nil {
+		log.Println(err)
+		return "The whisper is broken."
+	}
+	if to != c {
+		r.sendTo(to, b)
+	}
+	c.response <- b
+	return ""
+}
+
+// cmdWho lists the players in the room, with their player ids.
+func cmdWho(r *Room, c *Client, args string) string {
+	online := make([]*Client, 0, len(r.clients))
+	for client := range r.clients {
+		online = append(online, client)
+	}
+	sort.Slice(online, func(i, j int) bool {
+		return online[i].playerid < online[j].playerid
+	})
+	lines := []string{strconv.Itoa(len(online)) + " online in " + r.name + ":"}
+	for _, client := range online {
+		lines = append(lines, strconv.Itoa(client.playerid)+" "+client.username)
+	}
+	notify(c, strings.Join(lines, "\n"))
+	return ""
+}
+
+// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+
+// validNickname reports whether the name is short, and only made of
+// letters, digits, spaces, '-' and '_'.
+func validNickname(name string) bool {
+	if name == "" || len(name) > maxNicknameLength ||
+		name != strings.TrimSpace(name) {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case 'a' <= r && r <= 'z':
+		case 'A' <= r && r <= 'Z':
+		case '0' <= r && r <= '9':
+		case r == '-' || r == '_' || r == ' ':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// findClient returns the client in the room with the given username,
+// ignoring case, or nil.
+func (r *Room) findClient(name string) *Client {
+	for client := range r.clients {
+		if strings.EqualFold(client.username, name) {
+			return client
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package wschat
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fractalbach/fractalnet/game"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		body, name, args string
+	}{
+		{"/who", "/who", ""},
+		{"/me waves", "/me", "waves"},
+		{"/w Some One  hi there ", "/w", "Some One  hi there"},
+		{"/nick\tZed", "/nick", "Zed"},
+	}
+	for _, test := range tests {
+		name, args := splitCommand(test.body)
+		if name != test.name || args != test.args {
+			t.Errorf("splitCommand(%q) = %q, %q, want %q, %q",
+				test.body, name, args, test.name, test.args)
+		}
+	}
+}
+
+func TestValidNickname(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"Zed", true},
+		{"Some One_2-b", true},
+		{"", false},
+		{" Zed", false},
+		{"Zed ", false},
+		{"<b>Zed</b>", false},
+		{"123456789012345678901234", true},
+		{"1234567890123456789012345", false},
+	}
+	for _, test := range tests {
+		if ok := validNickname(test.name); ok != test.ok {
+			t.Errorf("validNickname(%q) = %v, want %v", test.name, ok, test.ok)
+		}
+	}
+}
+
+// replyCode waits for the Ack or Error in the client's response channel, and
+// returns the error code, or "" for an Ack.
+func replyCode(t *testing.T, c *Client) string {
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case r := <-c.response:
+			var reply struct {
+				Ack   *game.EventAck
+				Error *game.EventError
+			}
+			json.Unmarshal(r.([]byte), &reply)
+			switch {
+			case reply.Ack != nil:
+				return ""
+			case reply.Error != nil:
+				return reply.Error.Code
+			}
+		case <-timeout:
+			t.Fatalf("%s didn't get a reply", c.username)
+		}
+	}
+}
+
+func TestChatCommands(t *testing.T) {
+	hub := NewHub(testConfig())
+	a1, a2 := newTestClient(hub, "a1"), newTestClient(hub, "a2")
+	room := hub.join(a1, "a")
+	hub.join(a2, "a")
+	defer hub.leave(a2)
+	defer hub.leave(a1)
+
+	steps := []struct {
+		from *Client
+		body string
+		code string  // the error code of the reply, or "" for an Ack
+		to   *Client // who should see the text, if anyone
+		text string
+	}{
+		{a1, "hello", "", a2, "a1: hello"},
+		{a1, "/nick Zed", "", a2, "a1 is now known as Zed."},
+		{a2, "/nick zed", game.ErrBadCommand, nil, ""},
+		{a2, "/nick <b>", game.ErrBadCommand, nil, ""},
+		{a2, "/w Zed psst", "", a1, "a2 whispers to Zed: psst"},
+		{a2, "/w Nobody psst", game.ErrBadCommand, nil, ""},
+		{a1, "/me waves", "", a2, "* Zed waves"},
+		{a1, "/me", game.ErrBadCommand, nil, ""},
+		{a1, "/fly", game.ErrUnknownCommand, nil, ""},
+	}
+	for i, step := range steps {
+		room.chat <- chatRequest{step.from, &game.AbstractEvent{
+			EventType: "Chat", EventBody: step.body,
+		}}
+		if code := replyCode(t, step.from); code != step.code {
+			t.Errorf("step %d: %q got %q, want %q",
+				i, step.body, code, step.code)
+		}
+		if step.to != nil && !received(step.to, step.text) {
+			t.Errorf("step %d: %s didn't see %q",
+				i, step.to.username, step.text)
+		}
+	}
+}
+
+func TestChatHistoryGoesThroughTheRoom(t *testing.T) {
+	hub := NewHub(testConfig())
+	a1 := newTestClient(hub, "a1")
+	room := hub.join(a1, "a")
+	defer hub.leave(a1)
+
+	room.chat <- chatRequest{a1, &game.AbstractEvent{
+		EventType: "Chat", EventBody: "remember me",
+	}}
+	if code := replyCode(t, a1); code != "" {
+		t.Fatalf("the chat message got %q", code)
+	}
+
+	a1.eventSwitcher(&game.AbstractEvent{EventType: "ChatHistory"})
+	var msg ChatHistoryMessage
+	if err := json.Unmarshal((<-a1.response).([]byte), &msg); err != nil {
+		t.Fatal(err)
+	}
+	n := len(msg.ChatHistory)
+	if n == 0 || !strings.Contains(msg.ChatHistory[n-1].Chat, "remember me") {
+		t.Errorf("the chat history is %+v", msg.ChatHistory)
+	}
+	if code := replyCode(t, a1); code != "" {
+		t.Errorf("the ChatHistory event got %q", code)
+	}
+}
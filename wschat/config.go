@@ -0,0 +1,315 @@
+package wschat
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/fractalbach/fractalnet/cellular/engine"
+	"github.com/fractalbach/fractalnet/cellular/gameofwar"
+	"github.com/fractalbach/fractalnet/game"
+)
+
+// ===========================================================================
+//      Server Configuration
+// ___________________________________________________________________________
+//
+// The Config is loaded once at startup: first the defaults, then the json
+// config file (if there is one), and then the flags that were given on the
+// command line.  It is passed to the hub, which passes it to each room.
+//
+// Example config file:
+//
+//      {
+//          "Width": 64,
+//          "Height": 48,
+//          "TickPeriod": "250ms",
+//          "Rule": "war",
+//          "Topology": "bounded",
+//          "Seed": 0,
+//          "MaxActiveClients": 10,
+//          "MaxMessageSize": 30000,
+//          "ChatHistory": 40,
+//          "ChatDir": "chat",
+//          "JournalDir": "",
+//          "SnapshotDir": "snapshots",
+//          "AdminPassword": "",
+//          "Victory": {
+//              "Territory": 0.75,
+//              "Elimination": true,
+//              "TimeLimit": 0
+//          },
+//          "Economy": {
+//              "StartResources": 40,
+//              "MaxResources": 200,
+//              "Income": 1,
+//              "SquaresPerIncome": 400,
+//              "BombCost": 20,
+//              "BombCooldown": 8,
+//              "CellCost": 2
+//          }
+//      }
+//
+
+// Config holds the settings of the server.
+type Config struct {
+
+	// Width and Height are the size of the game grid in new rooms.  Rooms
+	// that are restored from a snapshot keep their own size.
+	Width  int
+	Height int
+
+	// TickPeriod is the time between generations in the Game of War.
+	TickPeriod Duration
+
+	// Rule is the name of the cellular automaton rule that the grid follows
+	// in new rooms, such as "war", "conway", "rgb" or "wave".
+	Rule string
+
+	// Topology decides what is past the edges of the grid in new rooms:
+	// "bounded", "torus" or "mirror".
+	Topology string
+
+	// Seed starts the random number generator of each new room, so that the
+	// rooms make the same boards and guest names every time.  If it is 0,
+	// then each room picks its own seed from the time.
+	Seed int64
+
+	// MaxActiveClients is the number of clients allowed on the server.
+	MaxActiveClients int
+
+	// MaxMessageSize is the largest message (in bytes) that a client can
+	// send.  Larger messages close the connection.
+	MaxMessageSize int64
+
+	// ChatHistory is the number of chat messages that are sent to a client
+	// when they join a room, and the size of each "ChatHistory" page.
+	ChatHistory int
+
+	// ChatDir is the directory where the chat history of each room is kept.
+	// If it is empty, then the chat history is only kept in memory.
+	ChatDir string
+
+	// JournalDir is the directory where the events of each room are
+	// journaled, so that games can be replayed.  If it is empty, then
+	// nothing is journaled.
+	JournalDir string
+
+	// SnapshotDir is the directory where admins save named snapshots of a
+	// room's world, to load them again later.
+	SnapshotDir string
+
+	// AdminPassword lets a client become an admin, with an "Admin" event.
+	// If it is empty, then nobody can.
+	AdminPassword string
+
+	// Victory decides when a round of the Game of War is over.
+	Victory gameofwar.VictoryConditions
+
+	// Economy sets the prices of bombs, and the income of each team.
+	Economy gameofwar.Economy
+}
+
+// Duration is a time.Duration that is written as a string, like "250ms",
+// in the json config file.
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return fmt.Errorf("durations are strings, like \"250ms\": %v", err)
+	}
+	d.Duration, err = time.ParseDuration(s)
+	return err
+}
+
+// DefaultConfig returns the settings that are used when nothing else has
+// been chosen.
+func DefaultConfig() *Config {
+	return &Config{
+		Width:            48,
+		Height:           48,
+		TickPeriod:       Duration{250 * time.Millisecond},
+		Rule:             gameofwar.DEFAULT_RULE,
+		Topology:         engine.TOPOLOGY_BOUNDED,
+		MaxActiveClients: 10,
+		MaxMessageSize:   30000,
+		ChatHistory:      40,
+		ChatDir:          "chat",
+		SnapshotDir:      "snapshots",
+		Victory: gameofwar.VictoryConditions{
+			Territory:   0.75,
+			Elimination: true,
+		},
+		Economy: gameofwar.Economy{
+			StartResources:   40,
+			MaxResources:     200,
+			Income:           1,
+			SquaresPerIncome: 400,
+			BombCost:         20,
+			BombCooldown:     8,
+			CellCost:         2,
+		},
+	}
+}
+
+// GameSettings returns the settings for the game world in each new room.
+func (c *Config) GameSettings() game.Settings {
+	return game.Settings{
+		Width:    c.Width,
+		Height:   c.Height,
+		Rule:     c.Rule,
+		Topology: c.Topology,
+		Seed:     c.Seed,
+		Victory:  c.Victory,
+		Economy:  c.Economy,
+
+		SnapshotDir: c.SnapshotDir,
+	}
+}
+
+// LoadConfig reads a json config file on top of the defaults, so that the
+// file only needs to have the settings that it changes.  If the path is
+// empty, then the defaults are returned.
+func LoadConfig(path string) (*Config, error) {
+	c := DefaultConfig()
+	if path == "" {
+		return c, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, c)
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %v", path, err)
+	}
+	return c, nil
+}
+
+// AddFlags defines a command line flag for each setting.  The flags write
+// into c, and their defaults are the values in c.
+func (c *Config) AddFlags(fs *flag.FlagSet) {
+	fs.IntVar(&c.Width, "width", c.Width,
+		"width of the game grid in new rooms")
+	fs.IntVar(&c.Height, "height", c.Height,
+		"height of the game grid in new rooms")
+	fs.DurationVar(&c.TickPeriod.Duration, "tick", c.TickPeriod.Duration,
+		"time between generations in the Game of War")
+	fs.StringVar(&c.Rule, "rule", c.Rule,
+		"cellular automaton rule of the grid in new rooms")
+	fs.StringVar(&c.Topology, "topology", c.Topology,
+		"edges of the grid in new rooms: bounded, torus or mirror")
+	fs.Int64Var(&c.Seed, "seed", c.Seed,
+		"seed of the random boards and names in new rooms (0 picks one)")
+	fs.IntVar(&c.MaxActiveClients, "max-clients", c.MaxActiveClients,
+		"number of clients allowed on the server")
+	fs.Int64Var(&c.MaxMessageSize, "max-message", c.MaxMessageSize,
+		"largest message (in bytes) that a client can send")
+	fs.IntVar(&c.ChatHistory, "chat-history", c.ChatHistory,
+		"number of chat messages sent to a client when they join a room")
+	fs.StringVar(&c.ChatDir, "chat", c.ChatDir,
+		"directory where the chat history of each room is kept")
+	fs.StringVar(&c.JournalDir, "journal", c.JournalDir,
+		"directory where the events of each room are journaled (empty turns it off)")
+	fs.StringVar(&c.SnapshotDir, "snapshot-dir", c.SnapshotDir,
+		"directory where admins save named snapshots of a room")
+	fs.StringVar(&c.AdminPassword, "admin-password", c.AdminPassword,
+		"password that makes a client an admin (empty means no admins)")
+	fs.Float64Var(&c.Victory.Territory, "win-territory", c.Victory.Territory,
+		"fraction of the board that a team needs to win (0 turns it off)")
+	fs.BoolVar(&c.Victory.Elimination, "win-elimination", c.Victory.Elimination,
+		"end the round when a team has no territory left")
+	fs.IntVar(&c.Victory.TimeLimit, "time-limit", c.Victory.TimeLimit,
+		"number of generations in a round (0 turns it off)")
+	fs.IntVar(&c.Economy.BombCost, "bomb-cost", c.Economy.BombCost,
+		"resources that a bomb costs")
+	fs.IntVar(&c.Economy.BombCooldown, "bomb-cooldown", c.Economy.BombCooldown,
+		"generations that a team waits between bombs")
+	fs.IntVar(&c.Economy.Income, "income", c.Economy.Income,
+		"resources that each team earns per generation")
+	fs.IntVar(&c.Economy.CellCost, "cell-cost", c.Economy.CellCost,
+		"resources that each living cell of a pattern costs")
+}
+
+// ApplyFlags copies the flags that were actually given on the command line
+// into c, so that they win over the config file.
+func (c *Config) ApplyFlags(set *flag.FlagSet) error {
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	c.AddFlags(fs)
+	var err error
+	set.Visit(func(f *flag.Flag) {
+		if err == nil && fs.Lookup(f.Name) != nil {
+			err = fs.Set(f.Name, f.Value.String())
+		}
+	})
+	return err
+}
+
+// Validate returns an error for the first setting that doesn't make sense.
+func (c *Config) Validate() error {
+	rule, err := engine.Lookup(c.Rule)
+	if err != nil {
+		return fmt.Errorf("Rule: %v", err)
+	}
+	if err := engine.ValidTopology(c.Topology); err != nil {
+		return fmt.Errorf("Topology: %v", err)
+	}
+	// The odd rows of a hex grid are pushed to the right, so they only line
+	// up across the top and bottom edges of a torus if the height is even.
+	if engine.GridOf(rule) == engine.GRID_HEX &&
+		c.Topology == engine.TOPOLOGY_TORUS && c.Height%2 != 0 {
+		return fmt.Errorf("Height must be even for a hex grid on a torus, "+
+			"not %d", c.Height)
+	}
+	switch {
+	// The grid can be as big as any other world (see game.MAX_WORLD_SIZE),
+	// so that a room can always be saved and loaded again.
+	case c.Width < 8 || c.Width > game.MAX_WORLD_SIZE:
+		return fmt.Errorf("Width must be between 8 and %d, not %d",
+			game.MAX_WORLD_SIZE, c.Width)
+	case c.Height < 8 || c.Height > game.MAX_WORLD_SIZE:
+		return fmt.Errorf("Height must be between 8 and %d, not %d",
+			game.MAX_WORLD_SIZE, c.Height)
+	case c.TickPeriod.Duration < 10*time.Millisecond:
+		return fmt.Errorf("TickPeriod must be at least 10ms, not %v",
+			c.TickPeriod.Duration)
+	case c.TickPeriod.Duration > time.Minute:
+		return fmt.Errorf("TickPeriod must be at most 1m, not %v",
+			c.TickPeriod.Duration)
+	case c.MaxActiveClients < 1:
+		return fmt.Errorf("MaxActiveClients must be at least 1, not %d",
+			c.MaxActiveClients)
+	case c.MaxMessageSize < 512:
+		return fmt.Errorf("MaxMessageSize must be at least 512, not %d",
+			c.MaxMessageSize)
+	case c.ChatHistory < 1 || c.ChatHistory > 1000:
+		return fmt.Errorf("ChatHistory must be between 1 and 1000, not %d",
+			c.ChatHistory)
+	case c.Victory.Territory < 0 || c.Victory.Territory > 1:
+		return fmt.Errorf("Victory.Territory must be between 0 and 1, not %v",
+			c.Victory.Territory)
+	case c.Victory.TimeLimit < 0:
+		return fmt.Errorf("Victory.TimeLimit can't be negative, not %d",
+			c.Victory.TimeLimit)
+	case c.Economy.StartResources < 0 || c.Economy.Income < 0 ||
+		c.Economy.SquaresPerIncome < 0 || c.Economy.BombCost < 0 ||
+		c.Economy.BombCooldown < 0 || c.Economy.CellCost < 0:
+		return fmt.Errorf("the Economy settings can't be negative: %+v",
+			c.Economy)
+	case c.Economy.MaxResources < c.Economy.BombCost:
+		return fmt.Errorf("Economy.MaxResources (%d) must be at least "+
+			"Economy.BombCost (%d), or nobody could ever drop a bomb",
+			c.Economy.MaxResources, c.Economy.BombCost)
+	}
+	return nil
+}
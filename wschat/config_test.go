@@ -0,0 +1,136 @@
+package wschat
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fractalbach/fractalnet/cellular/engine"
+	"github.com/fractalbach/fractalnet/cellular/gameofwar"
+	"github.com/fractalbach/fractalnet/game"
+)
+
+// writeConfig writes a config file into a new temporary directory, and
+// returns its path.  The caller removes the directory.
+func writeConfig(t *testing.T, text string) (dir, path string) {
+	dir, err := ioutil.TempDir("", "wschat-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path = filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return dir, path
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		text string
+		ok   bool
+		want func(c *Config) bool
+	}{
+		{`{}`, true, func(c *Config) bool {
+			return *c == *DefaultConfig()
+		}},
+		{`{"Width": 64, "TickPeriod": "1s"}`, true, func(c *Config) bool {
+			return c.Width == 64 && c.Height == DefaultConfig().Height &&
+				c.TickPeriod.Duration == time.Second
+		}},
+		{`{"ChatDir": ""}`, true, func(c *Config) bool {
+			return c.ChatDir == ""
+		}},
+		{`{"TickPeriod": 250}`, false, nil},
+		{`{"TickPeriod": "soon"}`, false, nil},
+		{`{"Width": 64`, false, nil},
+	}
+	for _, test := range tests {
+		dir, path := writeConfig(t, test.text)
+		c, err := LoadConfig(path)
+		os.RemoveAll(dir)
+		switch {
+		case test.ok && err != nil:
+			t.Errorf("%s: %v", test.text, err)
+		case !test.ok && err == nil:
+			t.Errorf("%s: loaded without an error", test.text)
+		case test.ok && !test.want(c):
+			t.Errorf("%s: loaded as %+v", test.text, c)
+		}
+	}
+
+	if c, err := LoadConfig(""); err != nil || *c != *DefaultConfig() {
+		t.Errorf("no config file gave %+v, %v", c, err)
+	}
+	if _, err := LoadConfig("does/not/exist.json"); err == nil {
+		t.Errorf("a missing config file loaded without an error")
+	}
+}
+
+func TestFlagsWinOverConfigFile(t *testing.T) {
+	dir, path := writeConfig(t, `{"Width": 64, "Height": 32}`)
+	defer os.RemoveAll(dir)
+
+	// The flags are defined on the defaults, before the file is read,
+	// just like in main.
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	DefaultConfig().AddFlags(fs)
+	if err := fs.Parse([]string{"-height", "100", "-tick", "1s"}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ApplyFlags(fs); err != nil {
+		t.Fatal(err)
+	}
+	if c.Width != 64 || c.Height != 100 ||
+		c.TickPeriod.Duration != time.Second {
+		t.Errorf("got %dx%d every %v, want 64x100 every 1s",
+			c.Width, c.Height, c.TickPeriod.Duration)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		change func(c *Config)
+		ok     bool
+	}{
+		{func(c *Config) {}, true},
+		{func(c *Config) { c.Width, c.Height = 8, 1024 }, true},
+		{func(c *Config) { c.Height = game.MAX_WORLD_SIZE }, true},
+		{func(c *Config) { c.Width = 7 }, false},
+		{func(c *Config) { c.Height = game.MAX_WORLD_SIZE + 1 }, false},
+		{func(c *Config) { c.TickPeriod.Duration = time.Millisecond }, false},
+		{func(c *Config) { c.TickPeriod.Duration = time.Hour }, false},
+		{func(c *Config) { c.MaxActiveClients = 0 }, false},
+		{func(c *Config) { c.MaxMessageSize = 100 }, false},
+		{func(c *Config) { c.ChatHistory = 0 }, false},
+		{func(c *Config) { c.Topology = engine.TOPOLOGY_TORUS }, true},
+		{func(c *Config) { c.Topology = engine.TOPOLOGY_MIRROR }, true},
+		{func(c *Config) { c.Topology = "klein bottle" }, false},
+		{func(c *Config) {
+			c.Rule, c.Topology, c.Height = gameofwar.HEX_RULE,
+				engine.TOPOLOGY_TORUS, 64
+		}, true},
+		{func(c *Config) {
+			c.Rule, c.Topology, c.Height = gameofwar.HEX_RULE,
+				engine.TOPOLOGY_TORUS, 63
+		}, false},
+		{func(c *Config) {
+			c.Rule, c.Topology, c.Height = gameofwar.HEX_RULE,
+				engine.TOPOLOGY_MIRROR, 63
+		}, true},
+	}
+	for i, test := range tests {
+		c := DefaultConfig()
+		test.change(c)
+		if err := c.Validate(); (err == nil) != test.ok {
+			t.Errorf("case %d: %+v: got %v, want ok: %v", i, c, err, test.ok)
+		}
+	}
+}
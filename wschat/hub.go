@@ -1,95 +1,134 @@
 package wschat
 
 import (
-	"github.com/fractalbach/fractalnet/game"
-	"github.com/fractalbach/fractalnet/namegen"
 	"log"
+	"sync"
 	"time"
 )
 
-var numberOfActiveClients int
+// defaultRoom is the room that clients join when they don't ask for one.
+const defaultRoom = "main"
 
-// hub maintains the game world and the set of active clients
+// maxRoomNameLength limits the size of the "room" query parameter.
+const maxRoomNameLength = 32
+
+// validRoomName reports whether the name is short, and only made of letters,
+// digits, '-' and '_'.  Room names are used as file names, so nothing else
+// is allowed.
+func validRoomName(name string) bool {
+	if len(name) == 0 || len(name) > maxRoomNameLength {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case 'a' <= r && r <= 'z':
+		case 'A' <= r && r <= 'Z':
+		case '0' <= r && r <= '9':
+		case r == '-' || r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Hub keeps track of the game rooms and the set of active clients.
+//
+// Rooms are created on demand, the first time that a client asks to join
+// them, and they are torn down as soon as the last client leaves.
 type Hub struct {
 
-	// Game Parallel Random Access Machine
-	pram *game.GamePram
+	// mu guards the rooms and clients maps.
+	mu sync.Mutex
+
+	// Open rooms, indexed by their name.
+	rooms map[string]*Room
 
-	// Registered clients.
-	clients map[*Client]bool
+	// Registered clients, and the room that each of them has joined.
+	clients map[*Client]*Room
 
-	// Inbound messages from the clients.
-	broadcast chan []byte
+	// Rooms from a snapshot, which are restored when somebody joins them.
+	saved map[string]*RoomSnapshot
 
-	// Register requests from the clients.
-	register chan *Client
+	// closed is true after the hub has been shut down.
+	closed bool
 
-	// Unregister requests from clients.
-	unregister chan *Client
+	// config holds the settings of the server, which are shared by every
+	// room.  It is never changed after the hub has been created.
+	config *Config
 }
 
-func NewHub() *Hub {
+// NewHub creates a hub, with the settings from the config.
+func NewHub(config *Config) *Hub {
 	return &Hub{
-		pram:       game.NewGamePram(),
-		clients:    make(map[*Client]bool),
-		broadcast:  make(chan []byte),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
+		rooms:   make(map[string]*Room),
+		clients: make(map[*Client]*Room),
+		saved:   make(map[string]*RoomSnapshot),
+		config:  config,
 	}
 }
 
-func (h *Hub) Run() {
-
-	// Set a Timer to Update the Tree Generations
-	// treeUpdateTicker := time.NewTicker(1 * time.Second)
-	// go h.treeUpdateTimer(treeUpdateTicker)
-	lifeUpdateTicker := time.NewTicker(250 * time.Millisecond)
-	go h.lifeUpdateTimer(lifeUpdateTicker)
-
-	// Enter Hub Loop; waiting for messages to arrive from clients.
-	for {
-		select {
-
-		case client := <-h.register:
-			h.clients[client] = true
-			numberOfActiveClients++
-			h.clientAutoLogin(client)
-			sendAllSavedMessages(client)
-			log.Println("There are now", numberOfActiveClients, "online.")
-
-		case client := <-h.unregister:
-			h.clientAutoLogout(client)
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-				numberOfActiveClients--
-			}
-			log.Println("There are now", numberOfActiveClients, "online.")
-
-		// Messages sent to the hub's broadcast channel,
-		// are sent to all other active clients.  If a message is unable
-		// to receive a broadcast message, that connection is dropped.
-		case message := <-h.broadcast:
-			if len(message) == 0 {
-				continue
-			}
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
-				}
-			}
-
-		} // End of Select
-	} // End of For Loop
-} // End of Hub Definition
+// join places the client into the named room, creating the room if it
+// doesn't exist yet.  The room is returned once the client is registered.
+// If the hub has been shut down, then nil is returned.
+func (h *Hub) join(c *Client, name string) *Room {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil
+	}
+	room, ok := h.rooms[name]
+	if !ok {
+		room = newRoom(name, h.saved[name], h.config)
+		delete(h.saved, name)
+		h.rooms[name] = room
+		go room.Run()
+		log.Println("Opened Room:", name)
+	}
+	h.clients[c] = room
+	room.members++
+	c.room = room
+	room.clientAutoLogin(c)
+	room.register <- c
+	return room
+}
+
+// leave removes the client from its room.  If that was the last client in
+// the room, then the room is closed and forgotten.
+func (h *Hub) leave(c *Client) {
+	h.mu.Lock()
+	room, ok := h.clients[c]
+	if !ok {
+		h.mu.Unlock()
+		return
+	}
+	delete(h.clients, c)
+	if h.closed {
+		h.mu.Unlock()
+
+		// The room was shut down with the client still inside, so the
+		// room won't close the response channel.  Once the game has
+		// stopped, nothing else will be sent on it.
+		<-room.done
+		close(c.response)
+		return
+	}
+	defer h.mu.Unlock()
+	room.unregister <- c
+	room.members--
+	if room.members <= 0 {
+		delete(h.rooms, room.name)
+		room.stop()
+		log.Println("Closed Room:", room.name)
+	}
+}
 
 // thereAreTooManyActiveClients counts the list of registered clients, and
 // returns TRUE if there are more than the "max".
 //
 func thereAreTooManyActiveClients(hub *Hub, max int) bool {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
 	return len(hub.clients) > max
 }
 
@@ -101,68 +140,3 @@ func thereAreTooManyActiveClients(hub *Hub, max int) bool {
 func prettyNow() string {
 	return time.Now().Format("3:04 PM")
 }
-
-// lifeUpdateTimer defines the actions of the timer, but not the rate of it.
-// It sends a game event to trigger an update to the next generation,
-// and a game event request for game state.
-// The Game state is broadcast to all active clients.
-func (h *Hub) lifeUpdateTimer(lifeUpdateTicker *time.Ticker) {
-	for t := range lifeUpdateTicker.C {
-		if numberOfActiveClients <= 0 {
-			continue
-		}
-		log.Println("Life Update:", t)
-		h.pram.UpdateLifeEvent()
-		h.broadcast <- h.pram.RequestSomething("LifeState")
-	}
-}
-
-// clientAutoLogin is temporary and essentially makes a guest account.
-//
-// A username is randomly generated using the "namegen" package, and a login
-// event is created and sent to the game, which should take of the assignment
-// of a object ID number.
-func (h *Hub) clientAutoLogin(c *Client) {
-	name := namegen.GenerateUsername()
-	playerId := h.pram.LoginEvent(name)
-	if playerId == 0 {
-		log.Println("Player Entity could not be created! Login failed!")
-		return
-	}
-	c.playerid = playerId
-	c.username = name
-	log.Println("New Login: (ID):", playerId, "(Username):", name)
-}
-
-// clientAutoLogout forces the logout of the player associated with this
-// connection.  As a result the playerID.
-func (h *Hub) clientAutoLogout(c *Client) {
-	if c.playerid == 0 {
-		log.Println("ClientAutoLogout not needed; Client has no playerid.")
-		return
-	}
-	log.Println("Attempting to Logout:", c)
-	h.pram.LogoutEvent(c.playerid)
-}
-
-var savedChatMessages [][]byte
-var maxMessages int = 40
-
-func saveNewMessage() {
-	if len(savedChatMessages) >= 40 {
-		savedChatMessages = savedChatMessages[1:40]
-	}
-}
-
-func addMessage(m []byte) {
-	if len(savedChatMessages) >= maxMessages {
-		savedChatMessages = savedChatMessages[1:maxMessages]
-	}
-	savedChatMessages = append(savedChatMessages, m)
-}
-
-func sendAllSavedMessages(c *Client) {
-	for _, v := range savedChatMessages {
-		c.send <- v
-	}
-}
@@ -0,0 +1,232 @@
+package wschat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fractalbach/fractalnet/game"
+	"github.com/gorilla/websocket"
+)
+
+// testConfig returns the default settings, but keeps the chat history in
+// memory, so that the tests don't write any files.
+func testConfig() *Config {
+	c := DefaultConfig()
+	c.ChatDir = ""
+	return c
+}
+
+// newTestClient returns a client without a websocket connection.  The room
+// only ever uses its channels, so that is all the tests need.
+func newTestClient(hub *Hub, name string) *Client {
+	return &Client{
+		hub:      hub,
+		send:     make(chan []byte, 256),
+		username: name,
+		response: make(chan interface{}, 256),
+		quit:     make(chan struct{}),
+	}
+}
+
+// roomNames returns the names of the hub's open rooms, sorted.
+func roomNames(hub *Hub) []string {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	names := []string{}
+	for name := range hub.rooms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRoomsOpenAndClose(t *testing.T) {
+	hub := NewHub(testConfig())
+	clients := map[string]*Client{}
+	for _, name := range []string{"alice", "bob", "carol", "dave"} {
+		clients[name] = newTestClient(hub, name)
+	}
+
+	steps := []struct {
+		join, leave string // client names
+		room        string
+		want        []string // open rooms after the step
+	}{
+		{join: "alice", room: "a", want: []string{"a"}},
+		{join: "bob", room: "a", want: []string{"a"}},
+		{join: "carol", room: "b", want: []string{"a", "b"}},
+		{leave: "alice", want: []string{"a", "b"}},
+		{leave: "carol", want: []string{"a"}},
+		{leave: "carol", want: []string{"a"}}, // leaving twice is harmless
+		{leave: "bob", want: []string{}},
+		{join: "dave", room: "a", want: []string{"a"}},
+		{leave: "dave", want: []string{}},
+	}
+	for i, step := range steps {
+		if step.join != "" {
+			c := clients[step.join]
+			if room := hub.join(c, step.room); room.name != step.room {
+				t.Fatalf("step %d: %s joined room %q, want %q",
+					i, step.join, room.name, step.room)
+			}
+		} else {
+			hub.leave(clients[step.leave])
+		}
+		if got := roomNames(hub); strings.Join(got, ",") !=
+			strings.Join(step.want, ",") {
+			t.Fatalf("step %d: open rooms are %q, want %q",
+				i, got, step.want)
+		}
+	}
+}
+
+func TestRoomsAreIndependent(t *testing.T) {
+	hub := NewHub(testConfig())
+	a1, a2 := newTestClient(hub, "a1"), newTestClient(hub, "a2")
+	b1 := newTestClient(hub, "b1")
+	roomA := hub.join(a1, "a")
+	hub.join(a2, "a")
+	hub.join(b1, "b")
+	defer func() {
+		for _, c := range []*Client{a1, a2, b1} {
+			hub.leave(c)
+		}
+	}()
+
+	roomA.chat <- chatRequest{a1, &game.AbstractEvent{
+		EventType: "Chat", EventBody: "hello, a",
+	}}
+	for _, c := range []*Client{a1, a2} {
+		if !received(c, "hello, a") {
+			t.Errorf("%s didn't get the chat message of its own room",
+				c.username)
+		}
+	}
+	if received(b1, "hello, a") {
+		t.Errorf("b1 got a chat message from another room")
+	}
+}
+
+// received waits a little while for a message containing the text to show
+// up in the client's send channel, skipping over anything else that the
+// room sends.
+func received(c *Client, message string) bool {
+	timeout := time.After(100 * time.Millisecond)
+	for {
+		select {
+		case m := <-c.send:
+			if strings.Contains(string(m), message) {
+				return true
+			}
+		case <-timeout:
+			return false
+		}
+	}
+}
+
+func TestServeWsRoomNames(t *testing.T) {
+	hub := NewHub(testConfig())
+	tests := []struct {
+		room    string
+		badName bool
+	}{
+		{"", false},
+		{"main", false},
+		{"Room_2-b", false},
+		{strings.Repeat("x", maxRoomNameLength), false},
+		{strings.Repeat("x", maxRoomNameLength+1), true},
+		{"a%20b", true},
+		{"..%2Fetc", true},
+		{"r%C3%A9sum%C3%A9", true},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/ws?room="+test.room, nil)
+		ServeWs(hub, w, r)
+
+		// A plain GET isn't a websocket handshake, so every request fails,
+		// but only the bad names should fail because of the name.
+		badName := w.Code == http.StatusBadRequest &&
+			strings.Contains(w.Body.String(), "Room name")
+		if badName != test.badName {
+			t.Errorf("room %q: got %d %q, want a bad name: %v",
+				test.room, w.Code, w.Body.String(), test.badName)
+		}
+	}
+	if got := roomNames(hub); len(got) != 0 {
+		t.Errorf("failed handshakes opened rooms %q", got)
+	}
+}
+
+func TestShutdownLetsClientsGo(t *testing.T) {
+	hub := NewHub(testConfig())
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) { ServeWs(hub, w, r) }))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?room=a"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	hub.mu.Lock()
+	var client *Client
+	for c := range hub.clients {
+		client = c
+	}
+	hub.mu.Unlock()
+
+	snap := hub.Shutdown("testing")
+	if snap.Rooms["a"] == nil {
+		t.Errorf("room a is missing from the snapshot")
+	}
+
+	// The connection is closed with the reason, and then the client leaves
+	// the hub, which closes its response channel.
+	for {
+		if _, _, err = conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+	if !strings.Contains(err.Error(), "testing") {
+		t.Errorf("the connection was closed with %v", err)
+	}
+	select {
+	case _, ok := <-client.response:
+		if ok {
+			t.Errorf("the response channel is still open")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("the response channel wasn't closed")
+	}
+}
+
+func TestSendingToAShutDownRoom(t *testing.T) {
+	room := newRoom("a", nil, testConfig())
+	go room.Run()
+	room.shutdown("testing")
+
+	c := newTestClient(NewHub(testConfig()), "late")
+	c.room = room
+	c.playerid = 1
+	done := make(chan bool)
+	go func() {
+		room.send([]byte("hello"))
+		c.eventSwitcher(&game.AbstractEvent{EventType: "Chat"})
+		c.eventSwitcher(&game.AbstractEvent{EventType: "LifeChange"})
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("sending to a shut down room blocked")
+	}
+}
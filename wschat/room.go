@@ -0,0 +1,380 @@
+package wschat
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fractalbach/fractalnet/cellular/gameofwar"
+	"github.com/fractalbach/fractalnet/game"
+	"github.com/gorilla/websocket"
+)
+
+// lagLimit is the number of queued messages at which a client is considered
+// to be lagging behind.  Lagging clients skip the grid updates, and get a
+// full grid state once they have caught up.
+var lagLimit = 128
+
+// Room is a single, independent game: it has its own game world, its own
+// tick loop, and its own chat history.  Everything inside of the room is
+// owned by the goroutine running Room.Run.
+type Room struct {
+
+	// name is the identifier used in "/ws?room=<name>".
+	name string
+
+	// Game Parallel Random Access Machine
+	pram *game.GamePram
+
+	// Registered clients.
+	clients map[*Client]bool
+
+	// Inbound messages from the clients.
+	broadcast chan []byte
+
+	// Inbound chat events: chat messages, which are saved before being
+	// broadcast, and chat commands.
+	chat chan chatRequest
+
+	// Register requests from the clients.
+	register chan *Client
+
+	// Unregister requests from clients.
+	unregister chan *Client
+
+	// done is closed when the room is torn down, or has been shut down.
+	done chan struct{}
+
+	// Shutdown requests from the hub.
+	shutdowns chan shutdownRequest
+
+	// history is the chat history of this room.
+	history ChatStore
+
+	// members is counted by the hub, while holding the hub's lock.
+	members int
+
+	// config holds the settings of the server.  It is shared, read-only.
+	config *Config
+}
+
+// shutdownRequest asks the room to close, and to reply with a snapshot.
+type shutdownRequest struct {
+	reason string
+	reply  chan *RoomSnapshot
+}
+
+// newRoom creates a room.  If a snapshot is given, then the room continues
+// from where the snapshot left off.  Otherwise, the game grid has the size
+// given in the config.
+func newRoom(name string, saved *RoomSnapshot, config *Config) *Room {
+	r := &Room{
+		name:       name,
+		clients:    make(map[*Client]bool),
+		broadcast:  make(chan []byte),
+		chat:       make(chan chatRequest),
+		register:   make(chan *Client),
+		unregister: make(chan *Client),
+		done:       make(chan struct{}),
+		shutdowns:  make(chan shutdownRequest),
+		config:     config,
+	}
+	history, err := openChatStore(config.ChatDir, name)
+	if err != nil {
+		log.Println("Chat history of", name, "is only kept in memory:", err)
+		history = &memoryChatStore{}
+	}
+	r.history = history
+	if saved == nil {
+		r.pram = r.startGame(game.MakeNewWorld(config.GameSettings()))
+		return r
+	}
+	world, err := game.RestoreWorld(saved.World, config.GameSettings())
+	if err != nil {
+		log.Println("Room", name, "could not be restored:", err)
+		r.pram = r.startGame(game.MakeNewWorld(config.GameSettings()))
+		return r
+	}
+	r.pram = r.startGame(world)
+	log.Println("Restored Room from snapshot:", name)
+	return r
+}
+
+// startGame runs the world in a Game PRAM.  If the config has a journal
+// directory, then the events of the world are recorded there.
+func (r *Room) startGame(w *game.World) *game.GamePram {
+	if r.config.JournalDir == "" {
+		return game.NewGamePramWithWorld(w)
+	}
+	journal, err := openJournal(r.config.JournalDir, r.name)
+	if err != nil {
+		log.Println("Events of", r.name, "are not being journaled:", err)
+		return game.NewGamePramWithWorld(w)
+	}
+	return game.NewGamePramWithJournal(w, journal)
+}
+
+// openJournal opens the journal file of a room, in the given directory.
+func openJournal(dir, room string) (game.Journal, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return game.OpenJournal(filepath.Join(dir, room+".journal"))
+}
+
+func (r *Room) Run() {
+
+	// Set a Timer to Update the Tree Generations
+	// treeUpdateTicker := time.NewTicker(1 * time.Second)
+	// go h.treeUpdateTimer(treeUpdateTicker)
+	lifeUpdateTicker := time.NewTicker(r.config.TickPeriod.Duration)
+	defer lifeUpdateTicker.Stop()
+
+	// Enter Room Loop; waiting for messages to arrive from clients.
+	for {
+		select {
+
+		case client := <-r.register:
+			r.clients[client] = true
+			r.sendTeam(client)
+			client.send <- r.pram.RequestSomething("Seed")
+			client.send <- r.pram.RequestSomething("Playback")
+			client.send <- r.pram.RequestSomething("Rule")
+			client.send <- r.pram.RequestSomething("Round")
+			client.send <- r.pram.RequestSomething("Score")
+			client.send <- r.chatHistoryMessage(0, r.config.ChatHistory)
+
+			// The full grid is sent from the room, so that it can't be
+			// overtaken by a grid update that happened after it.
+			client.sendGrid(r.pram.RequestGrid("LifeFrame"))
+			log.Println("There are now", len(r.clients), "online in", r.name)
+
+		case client := <-r.unregister:
+			r.clientAutoLogout(client)
+			if _, ok := r.clients[client]; ok {
+				delete(r.clients, client)
+				close(client.quit)
+			}
+			r.sendToAll([]byte(client.username + " has logged out."))
+
+			// The game handles events in order, so the logout has made it
+			// through after every event that this client has sent.  Nothing
+			// else will be sent on the response channel.
+			close(client.response)
+			log.Println("There are now", len(r.clients), "online in", r.name)
+
+		// Messages sent to the room's broadcast channel,
+		// are sent to all other active clients.  If a message is unable
+		// to receive a broadcast message, that connection is dropped.
+		case message := <-r.broadcast:
+			r.sendToAll(message)
+
+		case req := <-r.chat:
+			r.handleChat(req.client, req.event)
+
+		case <-lifeUpdateTicker.C:
+			r.lifeUpdate()
+
+		case req := <-r.shutdowns:
+			req.reply <- r.closeForShutdown(req.reason)
+			return
+
+		case <-r.done:
+			r.pram.Stop()
+			r.history.Close()
+			return
+
+		} // End of Select
+	} // End of For Loop
+} // End of Room Definition
+
+// stop tears down the room.  It must only be called once, after the last
+// client has left.
+func (r *Room) stop() {
+	close(r.done)
+}
+
+// send broadcasts the message to every client in the room, unless the room
+// is done.
+func (r *Room) send(message []byte) {
+	select {
+	case r.broadcast <- message:
+	case <-r.done:
+	}
+}
+
+// shutdown closes the room while clients are still connected, and returns
+// a snapshot of the room.  It is used when the whole server shuts down.
+func (r *Room) shutdown(reason string) *RoomSnapshot {
+	req := shutdownRequest{reason: reason, reply: make(chan *RoomSnapshot)}
+	r.shutdowns <- req
+	return <-req.reply
+}
+
+// closeForShutdown sends every client a close message with the reason, lets
+// the game handle the events that are still waiting, and then saves the
+// game world and the chat history.
+//
+// The room is done once the game has stopped, so that the hub can close the
+// response channels of the clients as they leave.  They can't be closed
+// here, because the clients might still be replying to their own events.
+func (r *Room) closeForShutdown(reason string) *RoomSnapshot {
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, reason)
+	for client := range r.clients {
+		client.conn.WriteControl(websocket.CloseMessage, msg,
+			time.Now().Add(time.Second))
+		close(client.quit)
+		delete(r.clients, client)
+	}
+	snap := &RoomSnapshot{World: r.pram.Shutdown()}
+	r.history.Close()
+	close(r.done)
+	return snap
+}
+
+// sendToAll sends the message to every client in the room, and drops the
+// clients that can't keep up.
+func (r *Room) sendToAll(message []byte) {
+	if len(message) == 0 {
+		return
+	}
+	for client := range r.clients {
+		r.sendTo(client, message)
+	}
+}
+
+// sendTo sends the message to a single client in the room, and drops the
+// client if it can't keep up.
+func (r *Room) sendTo(client *Client, message []byte) {
+	select {
+	case client.send <- message:
+	default:
+		close(client.quit)
+		delete(r.clients, client)
+	}
+}
+
+// lifeUpdate triggers an update to the next generation, and then broadcasts
+// the changes to all of the clients in the room, along with anything that
+// the game wants to announce (like somebody pausing it).
+func (r *Room) lifeUpdate() {
+	if len(r.clients) <= 0 {
+		return
+	}
+	r.pram.UpdateLifeEvent()
+	r.sendGrid(r.pram.RequestGrid("LifeDelta"))
+	for _, msg := range r.pram.RequestAnnouncements() {
+		r.sendToAll(msg)
+	}
+}
+
+// sendGrid sends a grid update to every client that is keeping up.
+//
+// A delta only makes sense to a client that has seen every update before
+// it.  So, clients that are lagging behind skip the update and are marked as
+// stale.  Stale clients get a full grid state once they have caught up.
+func (r *Room) sendGrid(update *gameofwar.GridUpdate) {
+
+	// Nothing changes while the game is paused, unless somebody changes it.
+	if update == nil || (!update.Full && len(update.Cells) == 0) {
+		return
+	}
+	var full *gameofwar.GridUpdate
+	for client := range r.clients {
+		if client.lagging() {
+			client.stale = true
+			continue
+		}
+		u := update
+		if client.stale {
+			if full == nil {
+				full = r.pram.RequestGrid("LifeFrame")
+			}
+			u = full
+			client.stale = false
+		}
+		if !client.sendGrid(u) {
+			close(client.quit)
+			delete(r.clients, client)
+		}
+	}
+}
+
+// clientAutoLogin is temporary and essentially makes a guest account.
+//
+// A login event is created and sent to the game, which should take of the
+// assignment of a object ID number.  The username is randomly generated by
+// the world (using the "namegen" package), so that a room started with the
+// same seed gives out the same names.
+//
+// clientAutoLogin is called before the client is registered into the room,
+// so it is the only goroutine touching the client at that time.
+func (r *Room) clientAutoLogin(c *Client) {
+	playerId, team, name := r.pram.LoginEvent(c.username)
+	if playerId == 0 {
+		log.Println("Player Entity could not be created! Login failed!")
+		return
+	}
+	c.playerid = playerId
+	c.team = team
+	c.username = name
+	log.Println("New Login: (ID):", playerId, "(Username):", name,
+		"(Team):", team, "(Room):", r.name)
+}
+
+// clientAutoLogout forces the logout of the player associated with this
+// connection.  As a result the playerID.
+//
+// Clients without a playerid are never allowed to send events to the game,
+// so nothing needs to be done for them.
+func (r *Room) clientAutoLogout(c *Client) {
+	if c.playerid == 0 {
+		log.Println("ClientAutoLogout not needed; Client has no playerid.")
+		return
+	}
+	log.Println("Attempting to Logout:", c.username, "from", r.name)
+	r.pram.LogoutEvent(c.playerid)
+}
+
+// sendTeam tells the client which team the server has placed them on.
+func (r *Room) sendTeam(c *Client) {
+	b, err := json.Marshal(game.TeamMessage{Team: c.team})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	c.send <- b
+}
+
+// saveChat adds the text to the chat history, and returns the chat message
+// that should be broadcast.
+func (r *Room) saveChat(text string) []byte {
+	entry, err := r.history.Append(text)
+	if err != nil {
+		log.Println("Chat message not saved in", r.name, ":", err)
+	}
+	b, err := json.Marshal(game.ChatMessage{Chat: entry.Chat, Id: entry.Id})
+	if err != nil {
+		log.Println(err)
+		return []byte{}
+	}
+	return b
+}
+
+// chatHistoryMessage returns a ChatHistory message with up to n chat
+// messages from before the given id (0 for the newest messages).
+func (r *Room) chatHistoryMessage(before, n int) []byte {
+	page, err := r.history.Before(before, n)
+	if err != nil {
+		log.Println("Chat history of", r.name, "could not be read:", err)
+	}
+	b, err := json.Marshal(ChatHistoryMessage{page})
+	if err != nil {
+		log.Println(err)
+		return []byte{}
+	}
+	return b
+}
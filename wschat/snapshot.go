@@ -0,0 +1,96 @@
+package wschat
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/fractalbach/fractalnet/game"
+)
+
+// Snapshot holds the state of every room on the server, so that it can be
+// saved when the server shuts down and loaded again when it starts up.
+type Snapshot struct {
+	Rooms map[string]*RoomSnapshot
+}
+
+// RoomSnapshot holds the game world of a room.  The chat history is not
+// included, because it is already saved by the room's ChatStore.
+type RoomSnapshot struct {
+	World *game.WorldSnapshot
+}
+
+// LoadSnapshot reads a snapshot from a json file.  If the file doesn't
+// exist, then an empty snapshot is returned, without an error.
+func LoadSnapshot(path string) (*Snapshot, error) {
+	snap := &Snapshot{Rooms: map[string]*RoomSnapshot{}}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return snap, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, snap)
+	if err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// SaveSnapshot writes a snapshot into a json file.  The snapshot is written
+// into a temporary file first, so that a failed write can't destroy the
+// previous snapshot.
+func SaveSnapshot(path string, snap *Snapshot) error {
+	b, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Restore keeps the rooms from the snapshot, so that they will be restored
+// the next time that somebody joins them.
+func (h *Hub) Restore(snap *Snapshot) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for name, rs := range snap.Rooms {
+		h.saved[name] = rs
+		log.Println("Room can be restored from snapshot:", name)
+	}
+}
+
+// Shutdown closes every room: each client is sent a close message with the
+// reason, the events that are waiting in the game are handled, and then the
+// room is saved into the returned snapshot.  Rooms from a previous snapshot
+// that nobody has joined are included as well.
+//
+// After Shutdown, nobody can join the hub.
+func (h *Hub) Shutdown(reason string) *Snapshot {
+	snap := &Snapshot{Rooms: map[string]*RoomSnapshot{}}
+
+	// The rooms are taken out of the hub while holding the lock, but they
+	// are shut down after letting go of it.  Shutting down a room waits for
+	// its game, and nothing that the game waits on should ever need to get
+	// past the lock of the hub.
+	h.mu.Lock()
+	h.closed = true
+	rooms := h.rooms
+	h.rooms = make(map[string]*Room)
+	for name, rs := range h.saved {
+		snap.Rooms[name] = rs
+	}
+	h.mu.Unlock()
+
+	for name, room := range rooms {
+		snap.Rooms[name] = room.shutdown(reason)
+		log.Println("Closed Room:", name)
+	}
+	return snap
+}
@@ -2,13 +2,14 @@ package wschat
 
 import (
 	"bytes"
+	"crypto/subtle"
 	"encoding/json"
 	"log"
 	"net/http"
 	"time"
 
+	"github.com/fractalbach/fractalnet/cellular/gameofwar"
 	"github.com/fractalbach/fractalnet/game"
-	"github.com/fractalbach/fractalnet/namegen"
 	"github.com/gorilla/websocket"
 )
 
@@ -21,12 +22,6 @@ const (
 
 	// Send pings to peer with this period. Must be less than pongWait.
 	pingPeriod = (pongWait * 9) / 10
-
-	// Maximum message size allowed from peer.
-	maxMessageSize = 30000
-
-	// Maximum number of active clients allowed.
-	maxActiveClients = 10
 )
 
 var (
@@ -34,9 +29,16 @@ var (
 	space   = []byte{' '}
 )
 
+// binaryProtocol is the websocket sub-protocol that a client can ask for,
+// in order to get grid updates as binary messages instead of json.
+// The format is described in the gameofwar package.  Every other message
+// is still sent as json text.
+const binaryProtocol = "fractalnet.grid.v1"
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	Subprotocols:    []string{binaryProtocol},
 	CheckOrigin: func(r *http.Request) bool {
 		return true
 	},
@@ -45,11 +47,62 @@ var upgrader = websocket.Upgrader{
 // Client is a middleman between the websocket connection and the hub.
 type Client struct {
 	hub      *Hub
+	room     *Room           // The game room that the client has joined.
 	conn     *websocket.Conn // The websocket connection.
 	send     chan []byte     // Buffered channel of outbound messages.
 	username string          // Username associated with a specific client.
 	playerid int
+	team     uint8 // Team assigned by the server: 1 or 2.
+
+	// response carries replies from the game back to this client.
+	// It is closed by the room, once the client has logged out.
 	response chan interface{}
+
+	// quit is closed by the room when the connection should be dropped.
+	quit chan struct{}
+
+	// stale is set by the room when the client has missed a grid update.
+	stale bool
+
+	// admin is set once the client has sent the admin password.  It is
+	// only used by readPump.
+	admin bool
+
+	// binary is true when the client asked for the binary sub-protocol.
+	// Binary grid updates are sent through the frames channel.
+	binary bool
+	frames chan []byte
+}
+
+// lagging reports whether the client has too many messages waiting to be
+// written to the websocket connection.
+func (c *Client) lagging() bool {
+	if c.binary {
+		return len(c.frames) >= cap(c.frames)/2
+	}
+	return len(c.send) >= lagLimit
+}
+
+// sendGrid queues the grid update in the format that the client asked for.
+// It returns false if the client's queue is full.
+func (c *Client) sendGrid(u *gameofwar.GridUpdate) bool {
+	if u == nil {
+		return true
+	}
+	if c.binary {
+		select {
+		case c.frames <- u.Binary():
+			return true
+		default:
+			return false
+		}
+	}
+	select {
+	case c.send <- u.JSON():
+		return true
+	default:
+		return false
+	}
 }
 
 // readPump pumps messages from the websocket connection to the hub.
@@ -59,12 +112,11 @@ type Client struct {
 // reads from this goroutine.
 func (c *Client) readPump() {
 	defer func() {
-		c.hub.broadcast <- []byte(c.username + " has logged out.")
 		log.Println("Client Un-Registered: ", c.conn.RemoteAddr())
-		c.hub.unregister <- c
+		c.hub.leave(c)
 		c.conn.Close()
 	}()
-	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadLimit(c.hub.config.MaxMessageSize)
 	c.conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.conn.SetPongHandler(func(string) error {
 		c.conn.SetReadDeadline(time.Now().Add(pongWait))
@@ -90,6 +142,8 @@ func (c *Client) readPump() {
 
 		if !(json.Valid(message)) {
 			log.Println("Ignored Invalid Json from ", c.conn.RemoteAddr())
+			c.replyError(&game.AbstractEvent{},
+				game.ErrInvalidJson, "The message is not valid json.")
 			continue
 		}
 
@@ -111,6 +165,7 @@ func (c *Client) readPump() {
 			event, err := game.MakePlayerEvent(message)
 			if err != nil {
 				log.Println(err)
+				c.replyError(event, game.ErrBadEvent, err.Error())
 				continue
 			}
 			c.eventSwitcher(event)
@@ -119,13 +174,17 @@ func (c *Client) readPump() {
 			eventArr, err := game.MakePlayerEventArray(message)
 			if err != nil {
 				log.Println(err)
+				c.replyError(&game.AbstractEvent{}, game.ErrBadEvent,
+					err.Error())
 				continue
 			}
-			for _, event := range *eventArr {
-				c.eventSwitcher(&event)
+			for i := range *eventArr {
+				c.eventSwitcher(&(*eventArr)[i])
 			}
 
 		default:
+			c.replyError(&game.AbstractEvent{}, game.ErrBadEvent,
+				"Events must be a json object, or an array of objects.")
 			continue
 		}
 	}
@@ -145,12 +204,13 @@ func (c *Client) writePump() {
 	for {
 		select {
 
-		case message, ok := <-c.send:
+		case <-c.quit:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+			return
+
+		case message := <-c.send:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
 			w, err := c.conn.NextWriter(websocket.TextMessage)
 			if err != nil {
 				return
@@ -168,6 +228,13 @@ func (c *Client) writePump() {
 				return
 			}
 
+		case frame := <-c.frames:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			err := c.conn.WriteMessage(websocket.BinaryMessage, frame)
+			if err != nil {
+				return
+			}
+
 		case <-ticker.C:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			err := c.conn.WriteMessage(websocket.PingMessage, nil)
@@ -182,11 +249,22 @@ func (c *Client) writePump() {
 func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
 
 	// Check to see if there are too many active clients already.
-	if thereAreTooManyActiveClients(hub, maxActiveClients) {
+	if thereAreTooManyActiveClients(hub, hub.config.MaxActiveClients) {
 		log.Println("Too many active clients.")
 		return
 	}
 
+	// Find out which room the client wants to join.
+	roomName := r.URL.Query().Get("room")
+	if roomName == "" {
+		roomName = defaultRoom
+	}
+	if !validRoomName(roomName) {
+		http.Error(w, "Room names can only have up to 32 letters, digits, "+
+			"'-' and '_'.", http.StatusBadRequest)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println(err)
@@ -199,26 +277,37 @@ func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
 		hub:      hub,
 		conn:     conn,
 		send:     make(chan []byte, 256),
-		username: namegen.GenerateUsername(),
 		response: make(chan interface{}),
+		quit:     make(chan struct{}),
+		binary:   conn.Subprotocol() == binaryProtocol,
+		frames:   make(chan []byte, 16),
 	}
 
-	// Register that new Client Object into the hub.
-	client.hub.register <- client
-	log.Println(
-		"Client Registered:", client.conn.RemoteAddr(), client.username)
+	// Register that new Client Object into the hub, which places it into
+	// the requested room.
+	room := client.hub.join(client, roomName)
+	if room == nil {
+		log.Println("The server is shutting down.")
+		conn.Close()
+		return
+	}
+	log.Println("Client Registered:", client.conn.RemoteAddr(),
+		client.username, "(Room):", room.name)
 
 	// Allow collection of memory referenced by the caller by doing all work in
 	// new goroutines.
 	go client.writePump()
-	go client.readPump()
 	go client.ResponseListener()
 
 	// Send a welcoming message, and then request game state messages to be
 	// displayed, so that the new player can learn about what is happening.
-	client.hub.broadcast <- []byte("Welcome, " + client.username + ".")
-	client.hub.broadcast <- client.hub.pram.RequestSomething("GameState")
-	client.hub.broadcast <- client.hub.pram.RequestSomething("LifeState")
+	// This happens before the readPump starts, so that the room can't be
+	// torn down while these messages are being sent.  It can still be shut
+	// down along with the server, and then nobody is listening.
+	room.send([]byte("Welcome, " + client.username + "."))
+	room.send(room.pram.RequestSomething("GameState"))
+
+	go client.readPump()
 }
 
 // ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -235,20 +324,48 @@ func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
 // NOTE: Try NOT to be redundant with this eventSwitcher.  It's starting to
 // look like the DoGameEvent() function...
 //
+// Every event gets exactly one Ack or Error reply.  Events that are handled
+// here are replied to here; all others are replied to by the game.
+//
 func (c *Client) eventSwitcher(event *game.AbstractEvent) {
+	if c.playerid == 0 {
+		c.replyError(event, game.ErrNotLoggedIn, "You are not logged in.")
+		return
+	}
 	switch event.EventType {
-	case "Chat":
-		message, err := json.Marshal(game.ChatMessage{
-			prettyNow() + " > " + c.username + ": " + event.GetEventBody()})
+	// Chat messages and chat commands are handled by the room, because
+	// commands can change the username, and look at the other clients.
+	//
+	// ChatHistory asks for the chat messages from before the id given in
+	// the "Integer" field, or for the newest messages if it is 0.  It goes
+	// through the room too, since the room is writing to the history.
+	case "Chat", "ChatHistory":
+		select {
+		case c.room.chat <- chatRequest{c, event}:
+		case <-c.room.done:
+		}
+		return
 
-		if err != nil {
-			log.Println(err)
+	// Admin makes the client an admin, if "EventBody" is the password.
+	case "Admin":
+		c.becomeAdmin(event)
+		return
+
+	// Admin events are tagged as coming from an admin, so that the game
+	// knows that they are allowed.
+	case "Pause", "Resume", "Step", "SetSpeed", "SetRule",
+		"SaveSnapshot", "LoadSnapshot":
+		if !c.admin {
+			c.replyError(event, game.ErrNotAllowed,
+				"Only admins can send that event.")
 			return
 		}
-
-		addMessage(message)
-		c.hub.broadcast <- message
+		event.SourceType = "Admin"
+		event.SourceId = c.playerid
+		event.Response = c.response
+		c.room.pram.CustomPlayerEvent(event)
 		return
+
 	/*
 		case "ToggleTree":
 			newVal := false
@@ -256,26 +373,57 @@ func (c *Client) eventSwitcher(event *game.AbstractEvent) {
 				newVal = true
 			}
 			x, y := event.Location.X, event.Location.Y
-			c.hub.broadcast <- c.hub.pram.ToggleTreeEvent(x, y, newVal)
+			c.room.broadcast <- c.room.pram.ToggleTreeEvent(x, y, newVal)
 	*/
 
 	default:
+		event.SourceId = c.playerid
 		event.Response = c.response
-		c.hub.pram.CustomPlayerEvent(event)
-		//c.hub.broadcast <- c.hub.pram.RequestGameState()
+		c.room.pram.CustomPlayerEvent(event)
+		//c.room.broadcast <- c.room.pram.RequestGameState()
+	}
+}
+
+// becomeAdmin checks the password in an "Admin" event.  The server has no
+// admins at all if it doesn't have a password.
+func (c *Client) becomeAdmin(event *game.AbstractEvent) {
+	password := c.hub.config.AdminPassword
+	if password == "" {
+		c.replyError(event, game.ErrNotAllowed,
+			"There are no admins on this server.")
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(event.EventBody), []byte(password)) != 1 {
+		log.Println("Wrong admin password from", c.conn.RemoteAddr())
+		c.replyError(event, game.ErrNotAllowed, "That is not the password.")
+		return
 	}
+	c.admin = true
+	log.Println("Player:", c.playerid, "is now an admin.")
+	c.response <- event.ReplyMessage(true)
 }
 
 // ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 
+// replyError sends an Error message back to this client, in reply to the
+// given event.
+func (c *Client) replyError(event *game.AbstractEvent, code, reason string) {
+	c.response <- event.ReplyMessage(event.NewError(code, reason))
+}
+
+// ResponseListener forwards replies from the game to the client.  It never
+// blocks the game: if the client is too far behind, the reply is dropped.
+// It stops when the room closes the response channel.
 func (c *Client) ResponseListener() {
-	for {
+	for msg := range c.response {
+		b, ok := msg.([]byte)
+		if !ok {
+			continue
+		}
 		select {
-		case msg := <-c.response:
-			b, ok := msg.([]byte)
-			if ok {
-				c.send <- b
-			}
+		case c.send <- b:
+		default:
+			log.Println("Dropped a response to Player:", c.playerid)
 		}
 	}
 }